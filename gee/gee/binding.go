@@ -0,0 +1,119 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Binding 把请求解析到结构体中
+type Binding interface {
+	Name() string
+	Bind(req *http.Request, obj interface{}) error
+}
+
+// BindingBody 可以从已经读取的请求体解析，ShouldBindBodyWith 使用它让多个 Binding 共享同一份请求体
+type BindingBody interface {
+	Binding
+	BindBody(body []byte, obj interface{}) error
+}
+
+var (
+	BindingJSON BindingBody = jsonBinding{}
+	BindingXML  BindingBody = xmlBinding{}
+)
+
+var errEmptyBody = errors.New("gee: request body is empty")
+
+type jsonBinding struct{}
+
+func (jsonBinding) Name() string { return "json" }
+
+// Bind 以流的方式解码请求体，不需要先把整个请求体读入内存
+func (jsonBinding) Bind(req *http.Request, obj interface{}) error {
+	if req.Body == nil {
+		return errEmptyBody
+	}
+	return decodeJSON(req.Body, obj)
+}
+
+func (jsonBinding) BindBody(body []byte, obj interface{}) error {
+	return decodeJSON(bytes.NewReader(body), obj)
+}
+
+func decodeJSON(r io.Reader, obj interface{}) error {
+	if err := json.NewDecoder(r).Decode(obj); err != nil {
+		if err == io.EOF {
+			return errEmptyBody
+		}
+		return err
+	}
+	return nil
+}
+
+type xmlBinding struct{}
+
+func (xmlBinding) Name() string { return "xml" }
+
+func (xmlBinding) Bind(req *http.Request, obj interface{}) error {
+	if req.Body == nil {
+		return errEmptyBody
+	}
+	return decodeXML(req.Body, obj)
+}
+
+func (xmlBinding) BindBody(body []byte, obj interface{}) error {
+	return decodeXML(bytes.NewReader(body), obj)
+}
+
+func decodeXML(r io.Reader, obj interface{}) error {
+	if err := xml.NewDecoder(r).Decode(obj); err != nil {
+		if err == io.EOF {
+			return errEmptyBody
+		}
+		return err
+	}
+	return nil
+}
+
+// ShouldBindWith 使用指定的 Binding 解析请求，出错时只返回错误，由调用方决定如何响应
+func (c *Context) ShouldBindWith(obj interface{}, b Binding) error {
+	return b.Bind(c.Req, obj)
+}
+
+func (c *Context) ShouldBindJSON(obj interface{}) error {
+	return c.ShouldBindWith(obj, BindingJSON)
+}
+
+func (c *Context) ShouldBindXML(obj interface{}) error {
+	return c.ShouldBindWith(obj, BindingXML)
+}
+
+// ShouldBindBodyWith 先通过 GetRawData 缓存请求体再解析，同一个请求可以依次尝试多种格式：
+// if err := c.ShouldBindBodyWith(&a, gee.BindingJSON); err != nil { c.ShouldBindBodyWith(&b, gee.BindingXML) }
+func (c *Context) ShouldBindBodyWith(obj interface{}, b BindingBody) error {
+	body, err := c.GetRawData()
+	if err != nil {
+		return err
+	}
+	return b.BindBody(body, obj)
+}
+
+// BindWith 解析失败时把错误记录为 ErrorTypeBind 并响应 400(请求体过大时为 413)，调用方只需要直接返回
+func (c *Context) BindWith(obj interface{}, b Binding) error {
+	if err := c.ShouldBindWith(obj, b); err != nil {
+		e := c.Error(err).SetType(ErrorTypeBind | ErrorTypePublic)
+		if !c.Written() {
+			c.Fail(errorStatusCode(e), err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Context) BindJSON(obj interface{}) error {
+	return c.BindWith(obj, BindingJSON)
+}
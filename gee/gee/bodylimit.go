@@ -0,0 +1,100 @@
+package gee
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+const (
+	originalBodyKey = "gee/originalBody" // BodyLimit 包装之前的请求体，供分组中的 BodyLimit 重新包装
+	bodyBytesKey    = "gee/bodyBytes"    // GetRawData 缓存的请求体
+)
+
+// ErrBodyTooLarge 是请求体超过 BodyLimit 限制时读取请求体返回的错误，ErrorHandler 会把它转换为 413
+var ErrBodyTooLarge = NewHTTPError(http.StatusRequestEntityTooLarge, "")
+
+// BodyLimit 中间件限制请求体最多 n 字节。读取超出限制时(Content-Length 超出时在第一次读取时)
+// 立即响应 413 并跳过后续 Handler，Handler 读取请求体得到 ErrBodyTooLarge，之后写出的内容会被丢弃。
+// 分组中再次使用 BodyLimit 会覆盖外层的限制，例如全局 1MB、上传分组 100MB：
+// r.Use(gee.BodyLimit(1<<20)); upload := r.Group("/upload"); upload.Use(gee.BodyLimit(100<<20))
+func BodyLimit(n int64) HandlerFunc {
+	return func(c *Context) {
+		body := c.Req.Body
+		if orig, ok := c.Get(originalBodyKey); ok {
+			body = orig.(io.ReadCloser) //外层已经包装过，基于原始请求体重新限制
+		} else {
+			c.Set(originalBodyKey, body)
+		}
+		if body != nil && body != http.NoBody {
+			w := c.Writer
+			if rw, ok := w.(*responseWriter); ok {
+				w = rw.ResponseWriter //net/http 据此在响应后关闭连接，不再读取剩余的请求体
+			}
+			counted := &countingBody{ReadCloser: body}
+			c.Req.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, counted, n), counted: counted, ctx: c, limit: n}
+		}
+		c.Next()
+	}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	counted *countingBody //MaxBytesReader 下层的原始请求体，超出限制时它读到的字节数大于 limit
+	ctx     *Context
+	limit   int64
+}
+
+// 统计从原始请求体读取的字节数
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.ctx.Req.ContentLength > b.limit {
+		b.exceed()
+		return 0, ErrBodyTooLarge
+	}
+	n, err := b.ReadCloser.Read(p)
+	//只有超出限制时才报告 ErrBodyTooLarge，连接断开等其他错误原样返回
+	if err != nil && err != io.EOF && b.counted.n > b.limit {
+		b.exceed()
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) exceed() {
+	c := b.ctx
+	if c.Written() {
+		return
+	}
+	c.Fail(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+	if rw, ok := c.Writer.(*responseWriter); ok {
+		rw.discard = true
+	}
+}
+
+// GetRawData 读取完整的请求体并缓存，之后可以重复调用，PostForm 等方法也仍然可以读取请求体
+func (c *Context) GetRawData() ([]byte, error) {
+	if data, ok := c.Get(bodyBytesKey); ok {
+		return data.([]byte), nil
+	}
+	if c.Req.Body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(c.Req.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(bodyBytesKey, data)
+	c.Req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
@@ -0,0 +1,138 @@
+package gee
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 不带 Content-Length 的请求体，只能在读取时发现超出限制
+type chunkedReader struct{ r *strings.Reader }
+
+func (c chunkedReader) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func TestBodyLimit(t *testing.T) {
+	r := New()
+	r.Use(BodyLimit(8))
+	r.POST("/echo", func(c *Context) {
+		data, err := c.GetRawData()
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%s", data)
+	})
+	r.POST("/form", func(c *Context) { c.String(http.StatusOK, "name=%s", c.PostForm("name")) })
+	upload := r.Group("/upload")
+	upload.Use(BodyLimit(32))
+	upload.POST("/file", func(c *Context) {
+		data, err := c.GetRawData()
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%d", len(data))
+	})
+
+	cases := []struct {
+		path   string
+		body   string
+		length bool
+		code   int
+		want   string
+	}{
+		{"/echo", "small", true, http.StatusOK, "small"},
+		{"/echo", "far too large", true, http.StatusRequestEntityTooLarge, `{"message":"Request Entity Too Large"}`},
+		{"/echo", "far too large", false, http.StatusRequestEntityTooLarge, `{"message":"Request Entity Too Large"}`},
+		{"/form", "name=a-very-long-name", true, http.StatusRequestEntityTooLarge, `{"message":"Request Entity Too Large"}`},
+		{"/upload/file", "larger than the global limit", false, http.StatusOK, "28"},
+		{"/upload/file", strings.Repeat("x", 40), true, http.StatusRequestEntityTooLarge, `{"message":"Request Entity Too Large"}`},
+	}
+	for _, tc := range cases {
+		var req *http.Request
+		if tc.length {
+			req = httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		} else {
+			req = httptest.NewRequest("POST", tc.path, chunkedReader{strings.NewReader(tc.body)})
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code || strings.TrimSpace(w.Body.String()) != tc.want {
+			t.Errorf("%s %q: got %d %q, want %d %q", tc.path, tc.body, w.Code, w.Body.String(), tc.code, tc.want)
+		}
+	}
+}
+
+// 读完 limit 字节后连接中断，应该返回原始错误而不是 ErrBodyTooLarge
+type brokenReader struct{ data []byte }
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if len(b.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func TestBodyLimitReadError(t *testing.T) {
+	r := New()
+	r.Use(BodyLimit(8))
+	r.POST("/echo", func(c *Context) {
+		if _, err := c.GetRawData(); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+		}
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/echo", &brokenReader{data: []byte("12345678")}))
+	if w.Code != http.StatusBadRequest || w.Body.String() != io.ErrUnexpectedEOF.Error() {
+		t.Fatalf("expect the original read error, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestShouldBindBodyWith(t *testing.T) {
+	type login struct {
+		User     string `json:"user" xml:"user"`
+		Password string `json:"password" xml:"password"`
+	}
+	r := New()
+	r.POST("/login", func(c *Context) {
+		var form login
+		if err := c.ShouldBindBodyWith(&form, BindingJSON); err != nil {
+			if err := c.ShouldBindBodyWith(&form, BindingXML); err != nil {
+				c.String(http.StatusBadRequest, "invalid body")
+				return
+			}
+		}
+		raw, _ := c.GetRawData()
+		c.String(http.StatusOK, "%s/%s %d", form.User, form.Password, len(raw))
+	})
+	r.POST("/bind", func(c *Context) {
+		var form login
+		if c.BindJSON(&form) != nil {
+			return
+		}
+		c.String(http.StatusOK, form.User)
+	})
+
+	bodies := map[string]string{
+		`{"user":"geektutu","password":"1234"}`:                         "geektutu/1234 37",
+		`<login><user>geektutu</user><password>1234</password></login>`: "geektutu/1234 61",
+	}
+	for body, want := range bodies {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/login", strings.NewReader(body)))
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s: got %d %q, want %q", body, w.Code, w.Body.String(), want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/bind", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("BindJSON should respond 400 on invalid body, got %d", w.Code)
+	}
+}
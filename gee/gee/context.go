@@ -3,7 +3,11 @@ package gee
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 type H map[string]interface{}
@@ -14,6 +18,7 @@ type Context struct {
 	Path   string
 	Method string
 	Params map[string]string //解析后的路由参数
+	Pattern string //匹配到的路由规则，例如 /hello/:name，未匹配到路由时为空
 	StatusCode int
 	// middleware
 	//需要在Context中保存,因为在设计中，中间件不仅作用在处理流程前，
@@ -21,16 +26,26 @@ type Context struct {
 	handlers []HandlerFunc //保存所有路由函数及中间件（注册中间件其实就是将中间件函数追加到handlers中）
 	index    int
 	engine *Engine //通过 Context 访问 Engine 中的 HTML 模板
+	// Keys 保存单次请求内中间件与 Handler 之间共享的数据(如请求ID、追踪信息)
+	Keys map[string]interface{}
+	// Errors 是通过 c.Error 记录的错误，由 ErrorHandler 转换为响应，Logger 打印
+	Errors ErrorList
+	// 中间件为当前请求设置的模板数据(如 csrfField)，渲染 HTML 时由 Engine 中的同名模板函数读取
+	templateValues map[string]interface{}
 }
 
+// 调用 Abort 后 index 被设置为该值，大于任何实际的 handlers 数量
+const abortIndex = math.MaxInt16
+
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
-	return &Context{
+	c := &Context{
 		Path:   req.URL.Path,
 		Method: req.Method,
 		Req:    req,
-		Writer: w,
 		index:  -1, //记录当前执行到第几个中间件
 	}
+	c.Writer = &responseWriter{ResponseWriter: w, ctx: c}
+	return c
 }
 
 //在中间件中调用Next方法时，控制权交给了下一个中间件，直到调用到最后一个中间件，然后再从后往前，调用每个中间件在Next方法之后定义的部分
@@ -44,8 +59,24 @@ func (c *Context) Next() {
 	}
 }
 
+// Abort 跳过后续尚未执行的中间件和 Handler，已经执行的中间件在 Next 之后的部分仍会执行
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted 判断当前请求是否已经被 Abort
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// AbortWithStatus 写出状态码并跳过后续的 Handler
+func (c *Context) AbortWithStatus(code int) {
+	c.Status(code)
+	c.Abort()
+}
+
 func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers) //这是短路中间件，如果使用 后续的中间件和handler就直接跳过了
+	c.Abort() //这是短路中间件，如果使用 后续的中间件和handler就直接跳过了
 	c.JSON(code, H{"message": err})
 }
 
@@ -55,6 +86,76 @@ func (c *Context) Param(key string) string {
 	return value
 }
 
+// Set 在当前请求的上下文中保存一个键值对，惰性初始化 Keys
+func (c *Context) Set(key string, value interface{}) {
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
+	}
+	c.Keys[key] = value
+}
+
+// Get 返回 Set 保存的值，exists 表示该键是否存在
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	value, exists = c.Keys[key]
+	return
+}
+
+// GetString 以字符串形式返回 Set 保存的值，不存在或类型不符时返回空字符串
+func (c *Context) GetString(key string) string {
+	if v, ok := c.Get(key); ok {
+		s, _ := v.(string)
+		return s
+	}
+	return ""
+}
+
+// 路由参数不存在时返回的错误
+func (c *Context) paramValue(key string) (string, error) {
+	value, ok := c.Params[key]
+	if !ok {
+		return "", fmt.Errorf("gee: route param %q not found", key)
+	}
+	return value, nil
+}
+
+// ParamInt 以 int 类型返回路由参数，参数不存在或不是整数时返回 error
+func (c *Context) ParamInt(key string) (int, error) {
+	value, err := c.paramValue(key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("gee: route param %q: %v", key, err)
+	}
+	return n, nil
+}
+
+// ParamUint64 以 uint64 类型返回路由参数，参数不存在或不是无符号整数时返回 error
+func (c *Context) ParamUint64(key string) (uint64, error) {
+	value, err := c.paramValue(key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("gee: route param %q: %v", key, err)
+	}
+	return n, nil
+}
+
+// ParamUUID 校验路由参数是否为 8-4-4-4-12 格式的 UUID，返回其小写形式
+func (c *Context) ParamUUID(key string) (string, error) {
+	value, err := c.paramValue(key)
+	if err != nil {
+		return "", err
+	}
+	if !paramConstraints["uuid"](value) {
+		return "", fmt.Errorf("gee: route param %q: %q is not a valid UUID", key, value)
+	}
+	return strings.ToLower(value), nil
+}
+
 func (c *Context) PostForm(key string) string {
 	//获取post请求中?后面的参数：http://localhost:9999/login?username=geektutu&password=1234
 	return c.Req.FormValue(key)
@@ -64,9 +165,17 @@ func (c *Context) Query(key string) string {
 	return c.Req.URL.Query().Get(key)
 }
 
+// Status 写出状态码。StatusCode 由 responseWriter 在真正写出时记录，重复的 WriteHeader 被丢弃时保持第一次的值
 func (c *Context) Status(code int) {
-	c.StatusCode = code
 	c.Writer.WriteHeader(code)
+	c.recordStatus(code)
+}
+
+// Writer 没有经过 responseWriter(例如被替换为其他实现)时，在这里记录第一次写出的状态码
+func (c *Context) recordStatus(code int) {
+	if c.StatusCode == 0 {
+		c.StatusCode = code
+	}
 }
 
 func (c *Context) SetHeader(key string, value string) {
@@ -84,10 +193,39 @@ func (c *Context) JSON(code int, obj interface{}) {
 	c.Status(code)
 	encoder := json.NewEncoder(c.Writer) //NewEncoder创建一个将数据写入w的Encoder
 	if err := encoder.Encode(obj); err != nil { //Encode将v的json编码写入输出流，并会写入一个换行符
+		c.Error(err).SetType(ErrorTypeRender)
 		http.Error(c.Writer, err.Error(), 500)
 	}
 }
 
+// 为当前请求设置模板数据，由 Engine.templateFuncs 中同名的请求级模板函数返回
+func (c *Context) setTemplateValue(name string, value interface{}) {
+	if c.templateValues == nil {
+		c.templateValues = make(map[string]interface{})
+	}
+	c.templateValues[name] = value
+}
+
+// Redirect 重定向到 location，code 一般为 301、302、307 或 308
+func (c *Context) Redirect(code int, location string) {
+	http.Redirect(c.Writer, c.Req, location, code)
+	c.recordStatus(code)
+}
+
+// 路由修正产生的重定向：GET 请求使用 301，其他方法使用 308 以保留请求方法和请求体
+func (c *Context) redirectPath(path string) {
+	code := http.StatusMovedPermanently
+	if c.Method != http.MethodGet {
+		code = http.StatusPermanentRedirect
+	}
+	path = "/" + strings.TrimLeft(path, "/") //避免 //host 形式的路径被当作协议相对 URL 重定向到外部站点
+	path = (&url.URL{Path: path}).EscapedPath() //c.Path 是解码后的路径，重新转义空格、? 等字符
+	if c.Req.URL.RawQuery != "" {
+		path += "?" + c.Req.URL.RawQuery
+	}
+	c.Redirect(code, path)
+}
+
 func (c *Context) Data(code int, data []byte) {
 	c.Status(code)
 	c.Writer.Write(data)
@@ -97,7 +235,8 @@ func (c *Context) HTML(code int, name string, data interface{}) {
 	c.SetHeader("Content-Type", "text/html")
 	c.Status(code)
 	//模板渲染
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
+	if err := c.engine.renderHTML(c.Writer, name, data, c.templateValues); err != nil {
+		c.Error(err).SetType(ErrorTypeRender)
 		c.Fail(500, err.Error())
 	}
 }
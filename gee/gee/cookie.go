@@ -0,0 +1,63 @@
+package gee
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// CookieOptions 是写入 Cookie 时的属性
+type CookieOptions struct {
+	Path     string
+	Domain   string
+	MaxAge   int // 单位秒，0 表示会话 Cookie，负数表示立即删除
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// DefaultCookieOptions 是 SetCookie 传入 nil 时使用的属性：全站有效，禁止脚本读取，跨站请求只在顶级导航时携带
+var DefaultCookieOptions = CookieOptions{
+	Path:     "/",
+	HttpOnly: true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+// SetCookie 写入 Cookie，value 会经过 URL 编码，opts 为 nil 时使用 DefaultCookieOptions
+func (c *Context) SetCookie(name, value string, opts *CookieOptions) {
+	if opts == nil {
+		opts = &DefaultCookieOptions
+	}
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    url.QueryEscape(value),
+		Path:     path,
+		Domain:   opts.Domain,
+		MaxAge:   opts.MaxAge,
+		Secure:   opts.Secure,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	})
+}
+
+// Cookie 返回请求中 Cookie 解码后的值，不存在时返回 http.ErrNoCookie
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// DeleteCookie 让浏览器删除 Cookie，Path 和 Domain 需要与写入时一致
+func (c *Context) DeleteCookie(name string, opts *CookieOptions) {
+	if opts == nil {
+		opts = &DefaultCookieOptions
+	}
+	expired := *opts
+	expired.MaxAge = -1
+	c.SetCookie(name, "", &expired)
+}
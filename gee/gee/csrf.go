@@ -0,0 +1,198 @@
+package gee
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	csrfTokenKey     = "gee/csrfToken" // 当前请求的 CSRF token 在 Context.Keys 中的键
+	csrfSecretLength = 32
+)
+
+// CSRFConfig 是 CSRF 中间件的配置，零值字段使用默认值
+type CSRFConfig struct {
+	CookieName string // 双重提交模式下保存密钥的 Cookie，默认 _csrf
+	HeaderName string // 提交 token 的请求头，默认 X-CSRF-Token
+	FieldName  string // 提交 token 的表单字段，默认 _csrf
+	// UseSession 把密钥保存在会话中而不是单独的 Cookie，需要先启用 Sessions 中间件
+	UseSession bool
+	// CookieOptions 是密钥 Cookie 的属性，默认使用 DefaultCookieOptions
+	CookieOptions *CookieOptions
+	// TrustedOrigins 是除本站外允许发起不安全请求的来源，例如 https://admin.example.com
+	TrustedOrigins []string
+	// ExemptPaths 中的路径不做校验，以 * 结尾时按前缀匹配，例如 /webhooks/*
+	ExemptPaths []string
+	// Exempt 返回 true 时不做校验
+	Exempt func(c *Context) bool
+	// ErrorHandler 处理校验失败的请求，默认返回 403
+	ErrorHandler HandlerFunc
+}
+
+// CSRF 使用默认配置的 CSRF 防护中间件，见 CSRFWithConfig
+func CSRF() HandlerFunc {
+	return CSRFWithConfig(CSRFConfig{})
+}
+
+// CSRFWithConfig 创建 CSRF 防护中间件。
+// 每个客户端持有一个随机密钥(保存在 Cookie 或会话中)，每个请求生成一个经过随机掩码的 token，
+// 通过模板函数 {{csrfField}}、{{csrfToken}} 或 c.CSRFToken() 下发给页面。
+// 对 POST/PUT/PATCH/DELETE 等不安全的方法，先校验 Origin/Referer 是否为本站或受信任的来源，
+// 再校验请求头或表单中的 token 是否与密钥匹配
+func CSRFWithConfig(config CSRFConfig) HandlerFunc {
+	if config.CookieName == "" {
+		config.CookieName = "_csrf"
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "X-CSRF-Token"
+	}
+	if config.FieldName == "" {
+		config.FieldName = "_csrf"
+	}
+	if config.CookieOptions == nil {
+		config.CookieOptions = &DefaultCookieOptions
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context) {
+			c.Fail(http.StatusForbidden, "CSRF token invalid")
+		}
+	}
+	trusted := make(map[string]bool, len(config.TrustedOrigins))
+	for _, origin := range config.TrustedOrigins {
+		trusted[strings.ToLower(strings.TrimRight(origin, "/"))] = true
+	}
+
+	return func(c *Context) {
+		secret := config.loadSecret(c)
+		if secret == nil {
+			secret = make([]byte, csrfSecretLength)
+			randomBytes(secret)
+			config.saveSecret(c, secret)
+		}
+		token := maskCSRFToken(secret)
+		c.Set(csrfTokenKey, token)
+		c.setTemplateValue("csrfToken", token)
+		c.setTemplateValue("csrfField", template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+			template.HTMLEscapeString(config.FieldName), template.HTMLEscapeString(token))))
+
+		if isSafeMethod(c.Method) || config.exempt(c) {
+			c.Next()
+			return
+		}
+		if !checkOrigin(c, trusted) {
+			config.ErrorHandler(c)
+			c.Abort()
+			return
+		}
+		sent := c.Req.Header.Get(config.HeaderName)
+		if sent == "" {
+			sent = c.Req.PostFormValue(config.FieldName)
+		}
+		if !validCSRFToken(sent, secret) {
+			config.ErrorHandler(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CSRFToken 返回当前请求的 CSRF token，用于 JSON 接口把 token 交给前端，前端在请求头中回传
+func (c *Context) CSRFToken() string {
+	return c.GetString(csrfTokenKey)
+}
+
+func (config *CSRFConfig) loadSecret(c *Context) []byte {
+	var encoded string
+	if config.UseSession {
+		s := c.Session()
+		if s == nil {
+			panic("gee: CSRF with UseSession requires the Sessions middleware")
+		}
+		encoded, _ = s.Get("_csrf_secret").(string)
+	} else {
+		encoded, _ = c.Cookie(config.CookieName)
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(secret) != csrfSecretLength {
+		return nil
+	}
+	return secret
+}
+
+func (config *CSRFConfig) saveSecret(c *Context, secret []byte) {
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	if config.UseSession {
+		c.Session().Set("_csrf_secret", encoded)
+		return
+	}
+	c.SetCookie(config.CookieName, encoded, config.CookieOptions)
+}
+
+func (config *CSRFConfig) exempt(c *Context) bool {
+	if config.Exempt != nil && config.Exempt(c) {
+		return true
+	}
+	for _, p := range config.ExemptPaths {
+		if p == c.Path || (strings.HasSuffix(p, "*") && strings.HasPrefix(c.Path, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// RFC 7231 中定义的安全方法不会修改服务端状态，不需要校验
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// 校验请求来源：优先使用 Origin，没有时使用 Referer；两者都没有时，HTTPS 请求拒绝，HTTP 请求只依赖 token 校验
+func checkOrigin(c *Context, trusted map[string]bool) bool {
+	source := c.Req.Header.Get("Origin")
+	if source == "" || source == "null" {
+		source = c.Req.Header.Get("Referer")
+	}
+	if source == "" {
+		return c.Scheme() != "https"
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, c.Host()) {
+		return true
+	}
+	return trusted[strings.ToLower(u.Scheme+"://"+u.Host)]
+}
+
+// 每次下发的 token 都不同：token = base64(随机掩码 + 掩码 XOR 密钥)，
+// 避免响应被压缩时通过长度变化推测出 token(BREACH 攻击)
+func maskCSRFToken(secret []byte) string {
+	token := make([]byte, 2*len(secret))
+	randomBytes(token[:len(secret)])
+	for i, b := range secret {
+		token[len(secret)+i] = token[i] ^ b
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func validCSRFToken(token string, secret []byte) bool {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != 2*len(secret) {
+		return false
+	}
+	unmasked := make([]byte, len(secret))
+	for i := range secret {
+		unmasked[i] = data[i] ^ data[len(secret)+i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
@@ -0,0 +1,47 @@
+package gee_test
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"gee"
+	"gee/geetest"
+)
+
+func TestCSRF(t *testing.T) {
+	r := gee.New()
+	r.SetHTMLTemplate(template.Must(r.NewTemplate("form.tmpl").Parse(`<form method="post">{{csrfField}}</form>`)))
+	r.Use(gee.CSRFWithConfig(gee.CSRFConfig{
+		ExemptPaths:    []string{"/webhooks/*"},
+		TrustedOrigins: []string{"https://admin.example.com"},
+	}))
+	r.GET("/form", func(c *gee.Context) { c.HTML(http.StatusOK, "form.tmpl", nil) })
+	r.POST("/login", func(c *gee.Context) { c.String(http.StatusOK, "ok") })
+	r.POST("/webhooks/github", func(c *gee.Context) { c.String(http.StatusOK, "hook") })
+
+	client := geetest.New(t, r)
+	page := client.GET("/form").Do().Status(http.StatusOK)
+	m := regexp.MustCompile(`name="_csrf" value="([^"]+)"`).FindStringSubmatch(page.BodyString())
+	if m == nil {
+		t.Fatalf("csrfField should render a hidden input, got %q", page.BodyString())
+	}
+	token := m[1]
+	if other := client.GET("/form").Do().BodyString(); other == page.BodyString() {
+		t.Fatalf("token should be masked differently for every request")
+	}
+
+	client.POST("/login").Form(url.Values{"_csrf": {token}}).Do().Status(http.StatusOK)
+	client.POST("/login").Header("X-CSRF-Token", token).Header("Origin", "https://admin.example.com").Do().
+		Status(http.StatusOK)
+	client.POST("/login").Do().Status(http.StatusForbidden)
+	client.POST("/login").Form(url.Values{"_csrf": {"forged"}}).Do().Status(http.StatusForbidden)
+	client.POST("/login").Header("X-CSRF-Token", token).Header("Origin", "https://evil.com").Do().
+		Status(http.StatusForbidden)
+	client.POST("/webhooks/github").Do().Status(http.StatusOK)
+
+	//换一个客户端(没有密钥 Cookie)，之前的 token 不再有效
+	geetest.New(t, r).POST("/login").Form(url.Values{"_csrf": {token}}).Do().Status(http.StatusForbidden)
+}
@@ -0,0 +1,184 @@
+package gee
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrorType 标记错误的来源和是否可以展示给客户端，可以按位组合
+type ErrorType uint64
+
+const (
+	// ErrorTypePrivate 是 c.Error 的默认类型，只记录日志，响应中使用状态码对应的通用描述
+	ErrorTypePrivate ErrorType = 1 << iota
+	// ErrorTypePublic 的错误信息可以直接返回给客户端
+	ErrorTypePublic
+	// ErrorTypeBind 是解析请求参数或请求体失败产生的错误，默认响应 400
+	ErrorTypeBind
+	// ErrorTypeRender 是渲染响应(模板、JSON 编码)失败产生的错误
+	ErrorTypeRender
+	// ErrorTypeAny 匹配任意类型
+	ErrorTypeAny ErrorType = 1<<64 - 1
+)
+
+// Error 是通过 c.Error 记录的错误及其元数据
+type Error struct {
+	Err  error
+	Type ErrorType
+	Meta interface{} // 附加信息，例如出错的字段名
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) IsType(t ErrorType) bool { return e.Type&t != 0 }
+
+// SetType 设置错误类型，返回自身以便链式调用：c.Error(err).SetType(gee.ErrorTypePublic)
+func (e *Error) SetType(t ErrorType) *Error {
+	e.Type = t
+	return e
+}
+
+func (e *Error) SetMeta(meta interface{}) *Error {
+	e.Meta = meta
+	return e
+}
+
+// ErrorList 是一次请求中记录的全部错误，按记录顺序排列
+type ErrorList []*Error
+
+// ByType 返回指定类型的错误
+func (l ErrorList) ByType(t ErrorType) ErrorList {
+	var list ErrorList
+	for _, e := range l {
+		if e.IsType(t) {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// Last 返回最后记录的错误，没有错误时返回 nil
+func (l ErrorList) Last() *Error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l[len(l)-1]
+}
+
+func (l ErrorList) String() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Error 记录一个错误但不写出响应，由 ErrorHandler 中间件统一转换为响应，Logger 会打印所有错误。
+// err 已经是 *Error 时直接记录，否则包装为 ErrorTypePrivate 类型
+func (c *Context) Error(err error) *Error {
+	if err == nil {
+		panic("gee: Context.Error called with a nil error")
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Err: err, Type: ErrorTypePrivate}
+	}
+	c.Errors = append(c.Errors, e)
+	return e
+}
+
+// HTTPError 是携带状态码的错误，ErrorHandler 不需要注册就能把它转换为对应的响应
+type HTTPError struct {
+	Code    int
+	Message string
+}
+
+// NewHTTPError 创建 HTTPError，message 为空时使用状态码对应的描述
+func NewHTTPError(code int, message string) *HTTPError {
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	return &HTTPError{Code: code, Message: message}
+}
+
+func (e *HTTPError) Error() string { return e.Message }
+
+// 常用的 HTTPError，可以用 errors.Is 判断，也可以用 fmt.Errorf("user %d: %w", id, gee.ErrNotFound) 包装
+var (
+	ErrBadRequest   = NewHTTPError(http.StatusBadRequest, "")
+	ErrUnauthorized = NewHTTPError(http.StatusUnauthorized, "")
+	ErrForbidden    = NewHTTPError(http.StatusForbidden, "")
+	ErrNotFound     = NewHTTPError(http.StatusNotFound, "")
+	ErrConflict     = NewHTTPError(http.StatusConflict, "")
+)
+
+type errorMapping struct {
+	target error
+	code   int
+}
+
+// ErrorRegistry 保存错误到状态码的映射，例如把 sql.ErrNoRows 映射为 404
+type ErrorRegistry struct {
+	mappings []errorMapping
+}
+
+func NewErrorRegistry() *ErrorRegistry {
+	return &ErrorRegistry{}
+}
+
+// Register 注册一个映射，错误链中包含 target(errors.Is)时响应 code；先注册的优先
+func (r *ErrorRegistry) Register(target error, code int) *ErrorRegistry {
+	r.mappings = append(r.mappings, errorMapping{target: target, code: code})
+	return r
+}
+
+// StatusCode 返回错误对应的状态码：先查注册的映射，再查错误链中的 HTTPError，
+// ErrorTypeBind 类型默认 400，其余默认 500
+func (r *ErrorRegistry) StatusCode(err error) int {
+	if r != nil {
+		for _, m := range r.mappings {
+			if errors.Is(err, m.target) {
+				return m.code
+			}
+		}
+	}
+	return errorStatusCode(err)
+}
+
+// 不依赖注册表的默认状态码
+func errorStatusCode(err error) int {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	var e *Error
+	if errors.As(err, &e) && e.IsType(ErrorTypeBind) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorHandler 中间件在 Handler 执行完后，把最后记录的错误转换为 JSON 响应 {"message": ...}；
+// 已经写出响应时不再处理。HTTPError 与 ErrorTypePublic 的错误信息返回给客户端，
+// 其余错误只返回状态码对应的描述，避免泄露内部信息。registry 为 nil 时只处理 HTTPError
+func ErrorHandler(registry *ErrorRegistry) HandlerFunc {
+	return func(c *Context) {
+		c.Next()
+		last := c.Errors.Last()
+		if last == nil || c.Written() {
+			return
+		}
+		code := registry.StatusCode(last)
+		message := http.StatusText(code)
+		var httpErr *HTTPError
+		if last.IsType(ErrorTypePublic) {
+			message = last.Error()
+		} else if errors.As(last.Err, &httpErr) {
+			message = httpErr.Message
+		}
+		c.JSON(code, H{"message": message})
+	}
+}
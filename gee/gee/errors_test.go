@@ -0,0 +1,65 @@
+package gee
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorHandler(t *testing.T) {
+	registry := NewErrorRegistry().Register(sql.ErrNoRows, http.StatusNotFound)
+	r := New()
+	r.Use(ErrorHandler(registry))
+	r.GET("/missing", func(c *Context) { c.Error(fmt.Errorf("user 42: %w", ErrNotFound)) })
+	r.GET("/row", func(c *Context) { c.Error(fmt.Errorf("query users: %w", sql.ErrNoRows)) })
+	r.GET("/private", func(c *Context) { c.Error(errors.New("dial tcp 10.0.0.5:5432: connection refused")) })
+	r.GET("/public", func(c *Context) {
+		c.Error(errors.New("quota exceeded")).SetType(ErrorTypePublic)
+	})
+	r.GET("/bind", func(c *Context) {
+		c.Error(errors.New("age must be a number")).SetType(ErrorTypeBind | ErrorTypePublic).SetMeta("age")
+	})
+	r.GET("/written", func(c *Context) {
+		c.String(http.StatusAccepted, "done")
+		c.Error(errors.New("audit log failed"))
+	})
+
+	cases := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/missing", http.StatusNotFound, `{"message":"Not Found"}`},
+		{"/row", http.StatusNotFound, `{"message":"Not Found"}`},
+		{"/private", http.StatusInternalServerError, `{"message":"Internal Server Error"}`},
+		{"/public", http.StatusInternalServerError, `{"message":"quota exceeded"}`},
+		{"/bind", http.StatusBadRequest, `{"message":"age must be a number"}`},
+		{"/written", http.StatusAccepted, "done"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+		if w.Code != tc.code || strings.TrimSpace(w.Body.String()) != tc.body {
+			t.Errorf("%s: got %d %q, want %d %q", tc.path, w.Code, w.Body.String(), tc.code, tc.body)
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	c := newContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	bind := c.Error(errors.New("bad json")).SetType(ErrorTypeBind)
+	c.Error(errors.New("template missing")).SetType(ErrorTypeRender)
+	if c.Error(bind) != bind || len(c.Errors) != 3 {
+		t.Fatalf("recording an *Error should reuse it, got %d errors", len(c.Errors))
+	}
+	if got := c.Errors.ByType(ErrorTypeBind); len(got) != 2 {
+		t.Fatalf("expected 2 bind errors, got %v", got)
+	}
+	if c.Errors.String() != "bad json; template missing; bad json" || c.Errors.Last() != bind {
+		t.Fatalf("unexpected error list %q", c.Errors.String())
+	}
+}
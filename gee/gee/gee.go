@@ -1,11 +1,14 @@
 package gee
 
 import (
+	"fmt"
 	"html/template"
-	"log"
+	"io"
+	"net"
 	"net/http"
 	"path"
 	"strings"
+	"sync"
 )
 
 //提供给框架用户，用来定义路由映射的处理方法
@@ -18,6 +21,7 @@ type (
 		middlewares []HandlerFunc // 支持中间件
 		parent      *RouterGroup  // 支持分组嵌套（保存父组对象） (暂时没有用到，可以删除)
 		engine      *Engine       // 所有组共享一个Engine实例（只在初始化时赋值一次，以后所有组都使用初始赋值，目的在于继承）
+		host        *hostRouter   // 通过 Engine.Host 创建的组绑定的主机，为 nil 时使用默认路由树
 		//为了Group有访问Router的能力，在Group中保存一个指针，指向Engine，整个框架的所有资源都是由Engine统一协调的，那么就可以通过Engine间接地访问各种接口了
 	}
 
@@ -30,13 +34,33 @@ type (
 		router        *router
 		groups        []*RouterGroup // 存储所有组
 		htmlTemplates *template.Template // 将所有的模板加载进内存（gee框架的模板渲染直接使用html/template提供的能力）
+		//htmlTemplates 从不直接执行，html/template 不允许克隆已经执行过的模板。
+		//没有请求级模板数据的请求使用它的副本 sharedTemplates，其余请求从 boundTemplates 中取出一个副本
+		sharedTemplates *template.Template
+		boundTemplates  *sync.Pool // 请求级模板函数绑定到 templateScope 的副本 *boundTemplate，可以重复使用
 		funcMap       template.FuncMap   // 所有的自定义模板渲染函数
+		namedRoutes   map[string]*Route  // 路由名称到路由的映射，用于反向生成 URL
+		hosts         []*hostRouter      // 按主机名划分的路由树
+		trustedProxies []*net.IPNet      // 受信任的反向代理，见 SetTrustedProxies
+
+		// RedirectTrailingSlash 请求路径与路由只差末尾的 / 时，重定向到路由的规范写法(例如 /hello/ -> /hello)
+		RedirectTrailingSlash bool
+		// RedirectFixedPath 清理多余的 /、. 和 .. 后重定向；未匹配时再忽略大小写查找路由，找到则重定向
+		RedirectFixedPath bool
+		// RemoveExtraSlash 匹配前合并多余的 /，直接处理而不重定向，通配符参数也不再包含重复的 /
+		RemoveExtraSlash bool
+		// HostProxyHeaders 是受信任的代理传递原始域名的额外请求头，在 Forwarded 与 X-Forwarded-Host 之后按顺序查看，见 Context.Host
+		HostProxyHeaders []string
+		// SSLProxyHeaders 是受信任的代理标记原始请求为 HTTPS 的额外请求头，例如 {"X-Forwarded-SSL": "on"}，见 Context.Scheme
+		SSLProxyHeaders map[string]string
+		// StrictSlash 区分末尾的 /，/hello 与 /hello/ 是不同的路由；在处理请求时读取，注册路由之后修改也会生效
+		StrictSlash bool
 	}
 )
 
 // New是gee.Engine的构造函数
 func New() *Engine {
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{router: newRouter(), namedRoutes: make(map[string]*Route)}
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
 	return engine
@@ -56,6 +80,7 @@ func (group *RouterGroup) Group(prefix string) *RouterGroup {
 		prefix: group.prefix + prefix,
 		parent: group, //父组
 		engine: engine,
+		host:   group.host, //子组与父组属于同一个主机
 	}
 	engine.groups = append(engine.groups, newGroup)
 	return newGroup
@@ -66,18 +91,28 @@ func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
 }
 
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
+func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) *Route {
 	pattern := group.prefix + comp //分组之前初始路由是"/"，分组之后初始路由是原来的节点前缀+当前字符comp
-	log.Printf("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	router := group.router()
+	router.addRoute(method, pattern, handler)
+	return &Route{engine: group.engine, router: router, Method: method, Pattern: pattern}
 }
 
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+// 组所属主机的路由树
+func (group *RouterGroup) router() *router {
+	if group.host != nil {
+		return group.host.router
+	}
+	return group.engine.router
 }
 
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+// GET 注册路由，返回的 *Route 可以继续调用 Name 为路由命名
+func (group *RouterGroup) GET(pattern string, handler HandlerFunc) *Route {
+	return group.addRoute("GET", pattern, handler)
+}
+
+func (group *RouterGroup) POST(pattern string, handler HandlerFunc) *Route {
+	return group.addRoute("POST", pattern, handler)
 }
 
 //加载静态文件
@@ -110,32 +145,142 @@ func (group *RouterGroup) Static(relativePath string, root string) {
 	group.GET(urlPattern, handler)
 }
 
-// 自定义模板函数
+// 自定义模板函数(同名时覆盖框架内置的 url 等模板函数)
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
 }
 
 //模板解析
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	engine.setTemplates(template.Must(engine.NewTemplate("").ParseGlob(pattern)))
+}
+
+func (engine *Engine) setTemplates(templ *template.Template) {
+	engine.htmlTemplates = templ
+	engine.sharedTemplates = template.Must(templ.Clone())
+	engine.boundTemplates = &sync.Pool{New: func() interface{} {
+		scope := &templateScope{}
+		clone, err := templ.Clone()
+		if err != nil {
+			return &boundTemplate{err: err}
+		}
+		return &boundTemplate{templ: clone.Funcs(engine.templateFuncs(scope)), scope: scope}
+	}}
+}
+
+// NewTemplate 创建已经注册了框架内置模板函数(url、csrfField 等)和 SetFuncMap 设置的函数的模板，
+// 用于自行解析模板后交给 SetHTMLTemplate，例如 r.SetHTMLTemplate(template.Must(r.NewTemplate("form").Parse(text)))
+func (engine *Engine) NewTemplate(name string) *template.Template {
+	return template.New(name).Funcs(engine.templateFuncs(nil))
+}
+
+// SetHTMLTemplate 直接使用已解析好的模板，框架内置的模板函数和 SetFuncMap 设置的函数会合并进去。
+// 模板中用到内置函数时需要用 NewTemplate 创建，否则解析时会报错。templ 不能是已经执行过的模板
+func (engine *Engine) SetHTMLTemplate(templ *template.Template) {
+	engine.setTemplates(templ.Funcs(engine.templateFuncs(nil)))
+}
+
+// RenderHTML 使用已加载的模板渲染 name 到 w，请求级的模板函数(csrfField 等)输出空值
+func (engine *Engine) RenderHTML(w io.Writer, name string, data interface{}) error {
+	return engine.renderHTML(w, name, data, nil)
+}
+
+// 请求级模板函数读取的数据，每个 boundTemplate 同一时刻只被一个请求使用
+type templateScope struct {
+	values map[string]interface{}
+}
+
+func (s *templateScope) get(name string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return s.values[name]
 }
 
+// 请求级模板函数绑定到 scope 的模板副本，只在创建时克隆一次
+type boundTemplate struct {
+	templ *template.Template
+	scope *templateScope
+	err   error
+}
+
+// values 是中间件为当前请求设置的模板数据，不为空时从 boundTemplates 取出一个副本，
+// 把 values 放入它的 scope 后渲染，结束后放回，不需要每次请求都克隆整个模板
+func (engine *Engine) renderHTML(w io.Writer, name string, data interface{}, values map[string]interface{}) error {
+	if engine.htmlTemplates == nil {
+		return fmt.Errorf("gee: html template %q is not loaded", name)
+	}
+	if len(values) == 0 {
+		return engine.sharedTemplates.ExecuteTemplate(w, name, data)
+	}
+	pool := engine.boundTemplates
+	bound := pool.Get().(*boundTemplate)
+	if bound.err != nil {
+		return bound.err
+	}
+	bound.scope.values = values
+	err := bound.templ.ExecuteTemplate(w, name, data)
+	bound.scope.values = nil
+	pool.Put(bound)
+	return err
+}
+
+// 框架内置的模板函数，再合并用户通过 SetFuncMap 设置的函数。
+// 请求级模板函数从 scope 中读取中间件设置的数据，scope 为 nil 或没有设置时输出空值
+func (engine *Engine) templateFuncs(scope *templateScope) template.FuncMap {
+	funcs := template.FuncMap{
+		"url": engine.URL, //{{url "login"}}、{{url "user" "id" .ID}}
+		//{{csrfField}} 输出带 CSRF token 的隐藏表单字段，由 CSRF 中间件设置
+		"csrfField": func() template.HTML {
+			field, _ := scope.get("csrfField").(template.HTML)
+			return field
+		},
+		"csrfToken": func() string {
+			token, _ := scope.get("csrfToken").(string)
+			return token
+		},
+		//<script nonce="{{cspNonce}}">，由 Secure 中间件生成
+		"cspNonce": func() string {
+			nonce, _ := scope.get("cspNonce").(string)
+			return nonce
+		},
+	}
+	for name, fn := range engine.funcMap {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// Run 启动 HTTP 服务，debug 模式下会先打印路由表
 func (engine *Engine) Run(addr string) (err error) {
+	debugPrintRoutes(engine.Routes())
+	debugPrint("Listening and serving HTTP on %s", addr)
 	return http.ListenAndServe(addr, engine)
 }
 
 //第一个参数是 ResponseWriter ，利用 ResponseWriter 可以构造针对该请求的响应
 //第二个参数是 Request ，该对象包含了该HTTP请求的所有的信息，比如请求地址、Header和Body等信息；
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c := newContext(w, req) //在调用router.handle之前，构造一个 Context 对象
+	c.engine = engine
+	host, hostParams := engine.matchHost(c.Host()) //经过受信任的代理时使用代理传递的原始域名
 	var middlewares []HandlerFunc
 	for _, group := range engine.groups {
 		//接收到一个具体请求时，通过 URL 的前缀判断该请求适用于哪些中间件
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
+		//Engine 自身的中间件对所有主机生效，其余组只对所属主机生效
+		if (group == engine.RouterGroup || group.host == host) && strings.HasPrefix(req.URL.Path, group.prefix) {
 			middlewares = append(middlewares, group.middlewares...)
 		}
 	}
-	c := newContext(w, req) //在调用router.handle之前，构造一个 Context 对象
 	c.handlers = middlewares //注册中间件其实就是将中间件函数追加到handlers中
-	c.engine = engine
-	engine.router.handle(c)
+	c.Params = hostParams //主机名中捕获的参数，路由参数会合并进来
+	writer := c.Writer.(*responseWriter)
+	if host != nil {
+		host.router.handle(c)
+	} else {
+		engine.router.handle(c)
+	}
+	if !writer.written {
+		writer.runBeforeWrite() //Handler 没有写出任何内容时，由 net/http 在返回后写出响应头
+	}
 }
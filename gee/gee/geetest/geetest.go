@@ -0,0 +1,318 @@
+// Package geetest 在内存中调用 gee.Engine 的 ServeHTTP 来测试 Handler，不需要启动真实的 HTTP 服务：
+//
+//	client := geetest.New(t, r)
+//	client.POST("/v1/login").Form(url.Values{"username": {"geektutu"}}).
+//		Do().
+//		Status(http.StatusOK).
+//		JSONPath("username", "geektutu")
+package geetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gee"
+)
+
+// 请求默认发往的地址，Cookie 按该域名保存
+const defaultBaseURL = "http://example.com"
+
+// Client 保存被测的 Engine 和跨请求共享的 Cookie
+type Client struct {
+	t      testing.TB
+	engine *gee.Engine
+	jar    http.CookieJar
+	base   *url.URL
+}
+
+// New 创建测试客户端，Cookie 会在同一个 Client 发出的请求之间自动保存和携带
+func New(t testing.TB, engine *gee.Engine) *Client {
+	jar, _ := cookiejar.New(nil)
+	base, _ := url.Parse(defaultBaseURL)
+	return &Client{t: t, engine: engine, jar: jar, base: base}
+}
+
+// Jar 返回客户端使用的 Cookie 容器
+func (cl *Client) Jar() http.CookieJar {
+	return cl.jar
+}
+
+func (cl *Client) GET(path string) *Request    { return cl.Request(http.MethodGet, path) }
+func (cl *Client) POST(path string) *Request   { return cl.Request(http.MethodPost, path) }
+func (cl *Client) PUT(path string) *Request    { return cl.Request(http.MethodPut, path) }
+func (cl *Client) PATCH(path string) *Request  { return cl.Request(http.MethodPatch, path) }
+func (cl *Client) DELETE(path string) *Request { return cl.Request(http.MethodDelete, path) }
+
+// Request 构造任意方法的请求，path 可以带查询字符串
+func (cl *Client) Request(method, path string) *Request {
+	return &Request{client: cl, method: method, path: path, header: make(http.Header), query: url.Values{}}
+}
+
+// Request 是链式调用的请求构造器
+type Request struct {
+	client  *Client
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	body    []byte
+	err     error
+}
+
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Cookie 只为本次请求附加 Cookie，不写入 Client 的 Cookie 容器
+func (r *Request) Cookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// Body 设置原始请求体
+func (r *Request) Body(contentType string, body []byte) *Request {
+	r.header.Set("Content-Type", contentType)
+	r.body = body
+	return r
+}
+
+// JSON 把 v 编码为 JSON 请求体
+func (r *Request) JSON(v interface{}) *Request {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+	}
+	return r.Body("application/json", data)
+}
+
+// Form 以 application/x-www-form-urlencoded 编码请求体
+func (r *Request) Form(values url.Values) *Request {
+	return r.Body("application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+// File 是 Multipart 请求中上传的一个文件
+type File struct {
+	Field    string // 表单字段名
+	Filename string
+	Content  []byte
+}
+
+// Multipart 以 multipart/form-data 编码普通字段和文件
+func (r *Request) Multipart(fields map[string]string, files ...File) *Request {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			r.err = err
+		}
+	}
+	for _, f := range files {
+		part, err := w.CreateFormFile(f.Field, f.Filename)
+		if err == nil {
+			_, err = part.Write(f.Content)
+		}
+		if err != nil {
+			r.err = err
+		}
+	}
+	if err := w.Close(); err != nil {
+		r.err = err
+	}
+	return r.Body(w.FormDataContentType(), buf.Bytes())
+}
+
+// Do 在内存中执行请求，返回可以继续断言的响应
+func (r *Request) Do() *Response {
+	t := r.client.t
+	t.Helper()
+	if r.err != nil {
+		t.Fatalf("geetest: building %s %s: %v", r.method, r.path, r.err)
+	}
+	target, err := r.client.base.Parse(r.path)
+	if err != nil {
+		t.Fatalf("geetest: invalid path %q: %v", r.path, err)
+	}
+	if len(r.query) > 0 {
+		q := target.Query()
+		for k, vs := range r.query {
+			for _, v := range vs {
+				q.Add(k, v)
+			}
+		}
+		target.RawQuery = q.Encode()
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req := httptest.NewRequest(r.method, target.String(), body)
+	for k, vs := range r.header {
+		req.Header[k] = vs
+	}
+	for _, c := range r.client.jar.Cookies(target) {
+		req.AddCookie(c)
+	}
+	for _, c := range r.cookies {
+		req.AddCookie(c)
+	}
+
+	w := httptest.NewRecorder()
+	r.client.engine.ServeHTTP(w, req)
+	if cookies := w.Result().Cookies(); len(cookies) > 0 {
+		r.client.jar.SetCookies(target, cookies)
+	}
+	return &Response{t: t, Recorder: w, engine: r.client.engine, request: r.method + " " + r.path}
+}
+
+// Response 封装 httptest.ResponseRecorder，断言失败时通过 t.Errorf 报告并继续执行
+type Response struct {
+	Recorder *httptest.ResponseRecorder
+	t        testing.TB
+	engine   *gee.Engine
+	request  string
+}
+
+func (r *Response) errorf(format string, args ...interface{}) {
+	r.t.Helper()
+	r.t.Errorf("%s: %s", r.request, fmt.Sprintf(format, args...))
+}
+
+func (r *Response) Code() int { return r.Recorder.Code }
+
+func (r *Response) BodyString() string { return r.Recorder.Body.String() }
+
+// Status 断言状态码
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.Recorder.Code != code {
+		r.errorf("expect status %d, got %d, body: %s", code, r.Recorder.Code, r.BodyString())
+	}
+	return r
+}
+
+// Header 断言响应头的值
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Header().Get(key); got != value {
+		r.errorf("expect header %s=%q, got %q", key, value, got)
+	}
+	return r
+}
+
+// Body 断言响应体完全相等
+func (r *Response) Body(expect string) *Response {
+	r.t.Helper()
+	if got := r.BodyString(); got != expect {
+		r.errorf("expect body %q, got %q", expect, got)
+	}
+	return r
+}
+
+// BodyContains 断言响应体包含 substr
+func (r *Response) BodyContains(substr string) *Response {
+	r.t.Helper()
+	if !strings.Contains(r.BodyString(), substr) {
+		r.errorf("expect body to contain %q, got %q", substr, r.BodyString())
+	}
+	return r
+}
+
+// DecodeJSON 把响应体解码到 v
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.errorf("decoding json body %q: %v", r.BodyString(), err)
+	}
+	return r
+}
+
+// JSONPath 断言 JSON 响应体中 path 处的值，path 以 . 分隔对象的键和数组下标，例如 data.items.0.name。
+// expect 会先经过一次 JSON 编解码再比较，因此可以直接传入 int 等 Go 类型
+func (r *Response) JSONPath(path string, expect interface{}) *Response {
+	r.t.Helper()
+	var doc interface{}
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), &doc); err != nil {
+		r.errorf("decoding json body %q: %v", r.BodyString(), err)
+		return r
+	}
+	got, err := lookupJSONPath(doc, path)
+	if err != nil {
+		r.errorf("json path %q: %v", path, err)
+		return r
+	}
+	var want interface{}
+	data, _ := json.Marshal(expect)
+	json.Unmarshal(data, &want)
+	if !reflect.DeepEqual(got, want) {
+		r.errorf("json path %q: expect %v, got %v", path, want, got)
+	}
+	return r
+}
+
+func lookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return doc, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found", key)
+			}
+			doc = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("invalid index %q for array of length %d", key, len(v))
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in %T", key, doc)
+		}
+	}
+	return doc, nil
+}
+
+// Cookie 返回响应中设置的 Cookie，不存在时返回 nil
+func (r *Response) Cookie(name string) *http.Cookie {
+	for _, c := range r.Recorder.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// HTML 断言响应体与使用 Engine 加载的模板 name 和 data 渲染的结果一致
+func (r *Response) HTML(name string, data interface{}) *Response {
+	r.t.Helper()
+	var buf bytes.Buffer
+	if err := r.engine.RenderHTML(&buf, name, data); err != nil {
+		r.errorf("rendering template %q: %v", name, err)
+		return r
+	}
+	if got := r.BodyString(); got != buf.String() {
+		r.errorf("expect template %q rendered as %q, got %q", name, buf.String(), got)
+	}
+	return r
+}
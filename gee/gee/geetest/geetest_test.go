@@ -0,0 +1,94 @@
+package geetest_test
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gee"
+	"gee/geetest"
+)
+
+func newEngine() *gee.Engine {
+	r := gee.New()
+	r.SetHTMLTemplate(template.Must(template.New("hello.tmpl").Parse(`<p>hello, {{.name}}</p>`)))
+	r.POST("/login", func(c *gee.Context) {
+		c.JSON(http.StatusOK, gee.H{"username": c.PostForm("username")})
+	})
+	r.POST("/echo", func(c *gee.Context) {
+		data, _ := ioutil.ReadAll(c.Req.Body)
+		c.Data(http.StatusCreated, data)
+	})
+	r.POST("/upload", func(c *gee.Context) {
+		file, header, err := c.Req.FormFile("file")
+		if err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		content, _ := ioutil.ReadAll(file)
+		c.JSON(http.StatusOK, gee.H{
+			"title": c.PostForm("title"),
+			"files": []gee.H{{"name": header.Filename, "size": len(content)}},
+		})
+	})
+	r.GET("/visit", func(c *gee.Context) {
+		count := 0
+		if cookie, err := c.Req.Cookie("visits"); err == nil {
+			count = len(cookie.Value)
+		}
+		http.SetCookie(c.Writer, &http.Cookie{Name: "visits", Value: strings.Repeat("x", count+1), Path: "/"})
+		c.String(http.StatusOK, "%d", count)
+	})
+	r.GET("/hello/:name", func(c *gee.Context) {
+		c.HTML(http.StatusOK, "hello.tmpl", gee.H{"name": c.Param("name")})
+	})
+	return r
+}
+
+func TestClient(t *testing.T) {
+	client := geetest.New(t, newEngine())
+
+	client.POST("/login").Form(url.Values{"username": {"geektutu"}}).Do().
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		JSONPath("username", "geektutu")
+
+	client.POST("/echo").JSON(gee.H{"id": 1}).Do().
+		Status(http.StatusCreated).
+		JSONPath("id", 1)
+
+	client.POST("/upload").
+		Multipart(map[string]string{"title": "avatar"}, geetest.File{Field: "file", Filename: "gee.png", Content: []byte("png")}).
+		Do().
+		Status(http.StatusOK).
+		JSONPath("title", "avatar").
+		JSONPath("files.0.size", 3)
+
+	client.GET("/visit").Do().Body("0")
+	client.GET("/visit").Do().Body("1") //Cookie 由客户端保存并在下一次请求中携带
+	client.GET("/visit").Do().Body("2")
+
+	client.GET("/hello/gee").Do().
+		Status(http.StatusOK).
+		HTML("hello.tmpl", gee.H{"name": "gee"}).
+		BodyContains("hello, gee")
+}
+
+func TestCreateTestContext(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gee.CreateTestContext(w, httptest.NewRequest("GET", "/?name=gee", nil))
+	gee.RequestID()(c)
+	if c.RequestID() == "" || w.Header().Get(gee.HeaderXRequestID) != c.RequestID() {
+		t.Fatalf("middleware should run against the test context")
+	}
+
+	handler := func(c *gee.Context) { c.String(http.StatusOK, "hello %s", c.Query("name")) }
+	handler(c)
+	if w.Code != http.StatusOK || w.Body.String() != "hello gee" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
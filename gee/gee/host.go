@@ -0,0 +1,87 @@
+package gee
+
+import (
+	"net"
+	"strings"
+)
+
+// hostRouter 是某个主机名(或主机名模式)独立的路由树
+type hostRouter struct {
+	pattern string   // 例如 api.example.com、:tenant.example.com
+	labels  []string // 按 . 切分后的各级域名
+	wild    bool     // 是否含有 :name 形式的参数
+	router  *router
+}
+
+// Host 返回绑定到指定主机名的 RouterGroup。每个主机拥有独立的路由树和中间件，
+// Engine.Use 注册的全局中间件对所有主机生效。
+// 主机名中的 :name 匹配任意一级子域名，例如 :tenant.example.com，捕获的值可以通过 c.Param("tenant") 获取
+func (engine *Engine) Host(pattern string) *RouterGroup {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	var h *hostRouter
+	for _, existing := range engine.hosts {
+		if existing.pattern == pattern {
+			h = existing
+			break
+		}
+	}
+	if h == nil {
+		h = &hostRouter{pattern: pattern, labels: strings.Split(pattern, "."), router: newRouter()}
+		for _, label := range h.labels {
+			if label == "" {
+				panic("gee: invalid host pattern " + pattern)
+			}
+			if label[0] == ':' {
+				h.wild = true
+			}
+		}
+		engine.hosts = append(engine.hosts, h)
+	}
+	group := &RouterGroup{engine: engine, host: h}
+	engine.groups = append(engine.groups, group)
+	return group
+}
+
+// 按请求的 Host 选择路由树：先匹配不含参数的主机名，再按注册顺序匹配带参数的主机名。
+// 没有匹配的主机时返回 nil，使用 Engine 默认的路由树
+func (engine *Engine) matchHost(host string) (*hostRouter, map[string]string) {
+	if len(engine.hosts) == 0 {
+		return nil, nil
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(host, ".")), ".")
+	for _, wild := range []bool{false, true} {
+		for _, h := range engine.hosts {
+			if h.wild != wild {
+				continue
+			}
+			if params, ok := h.match(labels); ok {
+				return h, params
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (h *hostRouter) match(labels []string) (map[string]string, bool) {
+	if len(labels) != len(h.labels) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, label := range h.labels {
+		if label[0] == ':' {
+			if labels[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[label[1:]] = labels[i]
+		} else if label != labels[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -2,6 +2,8 @@ package gee
 
 import (
 	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,6 +15,26 @@ func Logger() HandlerFunc {
 		// 处理请求（中间件可等待执行其他的中间件或用户自己定义的 Handler处理结束后，再做一些额外的操作）
 		c.Next()
 		// time.Since(t)计算程序处理时间
-		log.Printf("[%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		log.Printf("[%d] %s %s in %v%s%s", c.StatusCode, c.ClientIP(), c.Req.RequestURI, time.Since(t), logIDs(c), logErrors(c))
 	}
 }
+
+// 拼接请求ID和 trace-id，便于把日志与其他服务的日志、追踪系统关联起来；都没有时返回空字符串
+func logIDs(c *Context) string {
+	var b strings.Builder
+	if id := c.RequestID(); id != "" {
+		b.WriteString(" request_id=" + id)
+	}
+	if id := c.TraceID(); id != "" {
+		b.WriteString(" trace_id=" + id)
+	}
+	return b.String()
+}
+
+// 请求中通过 c.Error 记录的错误，以带引号的形式追加在日志末尾，避免错误信息中的换行打乱日志
+func logErrors(c *Context) string {
+	if len(c.Errors) == 0 {
+		return ""
+	}
+	return " errors=" + strconv.Quote(c.Errors.String())
+}
@@ -0,0 +1,217 @@
+package gee
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 未匹配到任何路由的请求统一使用该 route 标签，避免随机路径让时间序列数量失控
+const unmatchedRoute = "unmatched"
+
+// DefaultBuckets 是请求耗时直方图的默认分桶(单位：秒)，与 Prometheus 客户端库的默认值一致
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultMetrics 是 Metrics() 与 MetricsHandler() 使用的全局指标注册表
+var DefaultMetrics = NewMetricsRegistry(DefaultBuckets...)
+
+// 请求计数与耗时直方图的标签
+type requestLabels struct {
+	method string
+	route  string
+	status int
+}
+
+// 正在处理中的请求数只按方法和路由区分(请求未结束时还没有状态码)
+type routeLabels struct {
+	method string
+	route  string
+}
+
+type histogram struct {
+	counts []uint64 // 与 buckets 一一对应，保存落在该桶内(非累计)的次数
+	sum    float64
+	count  uint64
+}
+
+// MetricsRegistry 按路由收集 RED(Rate/Errors/Duration)指标，并以 Prometheus 文本格式输出。
+// 不依赖 Prometheus 客户端库，可以在离线环境中构建
+type MetricsRegistry struct {
+	mu        sync.Mutex
+	buckets   []float64
+	requests  map[requestLabels]uint64
+	durations map[requestLabels]*histogram
+	inFlight  map[routeLabels]int64
+}
+
+// NewMetricsRegistry 创建指标注册表，buckets 为空时使用 DefaultBuckets
+func NewMetricsRegistry(buckets ...float64) *MetricsRegistry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+	return &MetricsRegistry{
+		buckets:   b,
+		requests:  make(map[requestLabels]uint64),
+		durations: make(map[requestLabels]*histogram),
+		inFlight:  make(map[routeLabels]int64),
+	}
+}
+
+// Metrics 中间件把请求指标记录到 DefaultMetrics
+func Metrics() HandlerFunc {
+	return DefaultMetrics.Middleware()
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出 DefaultMetrics，挂载方式：r.GET("/metrics", gee.MetricsHandler())
+func MetricsHandler() HandlerFunc {
+	return DefaultMetrics.Handler()
+}
+
+// Middleware 记录请求数、耗时直方图和正在处理中的请求数。
+// route 标签使用匹配到的路由规则(Context.Pattern)而不是原始路径，例如 /hello/:name
+func (m *MetricsRegistry) Middleware() HandlerFunc {
+	return func(c *Context) {
+		route := routeLabels{method: c.Method, route: c.Pattern}
+		if route.route == "" {
+			route.route = unmatchedRoute
+		}
+		m.mu.Lock()
+		m.inFlight[route]++
+		m.mu.Unlock()
+
+		start := time.Now()
+		defer func() {
+			//放在 defer 中，handler panic 时也能让 in-flight 计数归位
+			status := c.StatusCode
+			err := recover()
+			if err != nil && !c.Written() {
+				status = http.StatusInternalServerError //外层的 Recovery 随后会写出 500
+			}
+			m.observe(route, status, time.Since(start))
+			if err != nil {
+				panic(err) //继续交给外层的 Recovery 处理
+			}
+		}()
+		c.Next()
+	}
+}
+
+func (m *MetricsRegistry) observe(route routeLabels, status int, elapsed time.Duration) {
+	if status == 0 {
+		status = http.StatusOK //没有显式写状态码时 net/http 默认返回 200
+	}
+	labels := requestLabels{method: route.method, route: route.route, status: status}
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[route]--
+	m.requests[labels]++
+	h, ok := m.durations[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[labels] = h
+	}
+	if i := sort.SearchFloat64s(m.buckets, seconds); i < len(m.buckets) {
+		h.counts[i]++
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Handler 输出 Prometheus 文本格式(text/plain; version=0.0.4)的指标
+func (m *MetricsRegistry) Handler() HandlerFunc {
+	return func(c *Context) {
+		var buf bytes.Buffer
+		m.Expose(&buf)
+		c.SetHeader("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Data(http.StatusOK, buf.Bytes())
+	}
+}
+
+// Expose 把全部指标按 Prometheus 文本格式写入 w，时间序列按标签排序，保证输出稳定
+func (m *MetricsRegistry) Expose(w io.Writer) {
+	buf := bufio.NewWriter(w)
+	defer buf.Flush()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requests := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		requests = append(requests, l)
+	}
+	sort.Slice(requests, func(i, j int) bool { return lessRequestLabels(requests[i], requests[j]) })
+
+	buf.WriteString("# HELP gee_http_requests_total Total number of HTTP requests handled.\n")
+	buf.WriteString("# TYPE gee_http_requests_total counter\n")
+	for _, l := range requests {
+		fmt.Fprintf(buf, "gee_http_requests_total{%s} %d\n", l.String(), m.requests[l])
+	}
+
+	buf.WriteString("# HELP gee_http_request_duration_seconds HTTP request latency in seconds.\n")
+	buf.WriteString("# TYPE gee_http_request_duration_seconds histogram\n")
+	for _, l := range requests {
+		h := m.durations[l]
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(buf, "gee_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				l.String(), formatFloat(upper), cumulative)
+		}
+		fmt.Fprintf(buf, "gee_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l.String(), h.count)
+		fmt.Fprintf(buf, "gee_http_request_duration_seconds_sum{%s} %s\n", l.String(), formatFloat(h.sum))
+		fmt.Fprintf(buf, "gee_http_request_duration_seconds_count{%s} %d\n", l.String(), h.count)
+	}
+
+	routes := make([]routeLabels, 0, len(m.inFlight))
+	for l := range m.inFlight {
+		routes = append(routes, l)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].route != routes[j].route {
+			return routes[i].route < routes[j].route
+		}
+		return routes[i].method < routes[j].method
+	})
+	buf.WriteString("# HELP gee_http_requests_in_flight Number of HTTP requests currently being handled.\n")
+	buf.WriteString("# TYPE gee_http_requests_in_flight gauge\n")
+	for _, l := range routes {
+		fmt.Fprintf(buf, "gee_http_requests_in_flight{method=\"%s\",route=\"%s\"} %d\n",
+			escapeLabel(l.method), escapeLabel(l.route), m.inFlight[l])
+	}
+}
+
+func (l requestLabels) String() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\",status=\"%d\"", escapeLabel(l.method), escapeLabel(l.route), l.status)
+}
+
+func lessRequestLabels(a, b requestLabels) bool {
+	if a.route != b.route {
+		return a.route < b.route
+	}
+	if a.method != b.method {
+		return a.method < b.method
+	}
+	return a.status < b.status
+}
+
+// 标签值中的反斜杠、双引号和换行需要转义
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
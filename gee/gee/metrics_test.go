@@ -0,0 +1,46 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetricsRegistry(0.1, 1)
+	r := New()
+	r.Use(Recovery(), m.Middleware())
+	r.GET("/hello/:name", func(c *Context) {
+		c.String(http.StatusOK, "hello %s", c.Param("name"))
+	})
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+	r.GET("/metrics", m.Handler())
+
+	for _, path := range []string{"/hello/geektutu", "/hello/gee", "/missing", "/panic"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	expects := []string{
+		`gee_http_requests_total{method="GET",route="/hello/:name",status="200"} 2`,
+		`gee_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`gee_http_requests_total{method="GET",route="/panic",status="500"} 1`, //panic 的请求记为 500 而不是 200
+		`gee_http_request_duration_seconds_bucket{method="GET",route="/hello/:name",status="200",le="+Inf"} 2`,
+		`gee_http_request_duration_seconds_count{method="GET",route="/hello/:name",status="200"} 2`,
+		`gee_http_requests_in_flight{method="GET",route="/metrics"} 1`, //输出指标的请求本身仍在处理中
+		`# TYPE gee_http_request_duration_seconds histogram`,
+	}
+	for _, e := range expects {
+		if !strings.Contains(body, e) {
+			t.Errorf("metrics output missing %q\n%s", e, body)
+		}
+	}
+	if strings.Contains(body, "geektutu") {
+		t.Fatalf("route label should use the pattern instead of the raw path\n%s", body)
+	}
+}
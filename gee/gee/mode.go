@@ -0,0 +1,50 @@
+package gee
+
+import (
+	"log"
+	"os"
+)
+
+// 运行模式：debug 模式下启动时会打印路由表等调试信息，release 模式保持安静
+const (
+	DebugMode   = "debug"
+	ReleaseMode = "release"
+	TestMode    = "test"
+)
+
+// EnvGeeMode 可以通过环境变量设置运行模式，例如 GEE_MODE=release
+const EnvGeeMode = "GEE_MODE"
+
+var geeMode = DebugMode
+
+func init() {
+	SetMode(os.Getenv(EnvGeeMode))
+}
+
+// SetMode 设置运行模式，传入空字符串时使用 debug 模式
+func SetMode(value string) {
+	switch value {
+	case "":
+		geeMode = DebugMode
+	case DebugMode, ReleaseMode, TestMode:
+		geeMode = value
+	default:
+		panic("gee mode unknown: " + value + " (available mode: debug release test)")
+	}
+}
+
+// Mode 返回当前运行模式
+func Mode() string {
+	return geeMode
+}
+
+// IsDebugging 判断是否处于 debug 模式
+func IsDebugging() bool {
+	return geeMode == DebugMode
+}
+
+func debugPrint(format string, values ...interface{}) {
+	if IsDebugging() {
+		log.Printf("[GEE-debug] "+format, values...)
+	}
+}
@@ -0,0 +1,212 @@
+package gee
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SetTrustedProxies 设置受信任的反向代理，元素可以是 IP 或 CIDR，例如 10.0.0.0/8。
+// 只有直接连接的对端在列表中时，ClientIP、Scheme 和 Host 才会采信 Forwarded、X-Forwarded-* 和 X-Real-IP 请求头；
+// 默认不信任任何代理，传入 nil 恢复默认
+func (engine *Engine) SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return &net.ParseError{Type: "IP address", Text: p}
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			p += "/" + strconv.Itoa(bits)
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, ipNet)
+	}
+	engine.trustedProxies = nets
+	return nil
+}
+
+func (engine *Engine) isTrustedProxy(ip net.IP) bool {
+	for _, n := range engine.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteIP 返回直接连接的对端IP(Request.RemoteAddr 去掉端口)，不考虑任何代理请求头
+func (c *Context) RemoteIP() string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(c.Req.RemoteAddr))
+	if err != nil {
+		return strings.TrimSpace(c.Req.RemoteAddr)
+	}
+	return host
+}
+
+// 对端是受信任的代理时才解析代理请求头
+func (c *Context) fromTrustedProxy() bool {
+	if c.engine == nil || len(c.engine.trustedProxies) == 0 {
+		return false
+	}
+	ip := net.ParseIP(c.RemoteIP())
+	return ip != nil && c.engine.isTrustedProxy(ip)
+}
+
+// ClientIP 返回客户端的真实IP。对端是受信任的代理时，依次查看 Forwarded(RFC 7239)、X-Forwarded-For 和 X-Real-IP：
+// 从右向左跳过受信任的代理，第一个不受信任的地址就是客户端(更左边的值可能是客户端伪造的)；
+// 否则返回 RemoteIP
+func (c *Context) ClientIP() string {
+	if !c.fromTrustedProxy() {
+		return c.RemoteIP()
+	}
+	if elem := c.forwarded(); elem != nil {
+		return net.ParseIP(forwardedNode(elem["for"])).String()
+	}
+	if chain := headerList(c.Req.Header, "X-Forwarded-For"); len(chain) > 0 {
+		if i := c.untrustedHop(chain); i >= 0 {
+			return net.ParseIP(chain[i]).String()
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(c.Req.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return c.RemoteIP()
+}
+
+// Scheme 返回客户端请求使用的协议(http 或 https)，对端是受信任的代理时采信 Forwarded 的 proto、X-Forwarded-Proto
+// 和 Engine.SSLProxyHeaders
+func (c *Context) Scheme() string {
+	if c.fromTrustedProxy() {
+		if elem := c.forwarded(); elem != nil && elem["proto"] != "" {
+			return strings.ToLower(elem["proto"])
+		}
+		if proto := lastValue(headerList(c.Req.Header, "X-Forwarded-Proto")); proto != "" {
+			return strings.ToLower(proto)
+		}
+		for name, value := range c.engine.SSLProxyHeaders {
+			if strings.EqualFold(c.Req.Header.Get(name), value) {
+				return "https"
+			}
+		}
+	}
+	if c.Req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host 返回客户端请求的域名(可能带端口)，对端是受信任的代理时采信 Forwarded 的 host、X-Forwarded-Host
+// 和 Engine.HostProxyHeaders
+func (c *Context) Host() string {
+	if c.fromTrustedProxy() {
+		if elem := c.forwarded(); elem != nil && elem["host"] != "" {
+			return elem["host"]
+		}
+		if host := lastValue(headerList(c.Req.Header, "X-Forwarded-Host")); host != "" {
+			return host
+		}
+		for _, name := range c.engine.HostProxyHeaders {
+			if host := c.Req.Header.Get(name); host != "" {
+				return host
+			}
+		}
+	}
+	return c.Req.Host
+}
+
+// 解析 Forwarded 请求头，返回客户端所在的那一跳(从右向左第一个 for 不受信任的元素)，
+// 该元素是由受信任的代理追加的，其中的 proto 与 host 也是可信的；没有该请求头或格式错误时返回 nil
+func (c *Context) forwarded() map[string]string {
+	values := headerList(c.Req.Header, "Forwarded")
+	if len(values) == 0 {
+		return nil
+	}
+	elems := make([]map[string]string, 0, len(values))
+	chain := make([]string, 0, len(values))
+	for _, v := range values {
+		elem := parseForwardedElement(v)
+		if elem == nil || elem["for"] == "" {
+			return nil
+		}
+		elems = append(elems, elem)
+		chain = append(chain, forwardedNode(elem["for"]))
+	}
+	if i := c.untrustedHop(chain); i >= 0 {
+		return elems[i]
+	}
+	return nil
+}
+
+// 从右向左找到第一个不受信任的地址，全部受信任时返回最左边的地址；遇到无法解析的地址时返回 -1
+func (c *Context) untrustedHop(chain []string) int {
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(chain[i])
+		if ip == nil {
+			return -1
+		}
+		if i == 0 || !c.engine.isTrustedProxy(ip) {
+			return i
+		}
+	}
+	return -1
+}
+
+// 解析 Forwarded 中的一个元素，例如 for="[2001:db8::1]:4711";proto=https;host=example.com
+func parseForwardedElement(s string) map[string]string {
+	elem := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.IndexByte(pair, '=')
+		if i <= 0 {
+			return nil
+		}
+		value := pair[i+1:]
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		elem[strings.ToLower(pair[:i])] = value
+	}
+	return elem
+}
+
+// for 的值可能带端口，IPv6 地址用方括号括起来
+func forwardedNode(node string) string {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+}
+
+// 同名请求头可能出现多次，每个值又可能以逗号分隔，按出现顺序展开
+func headerList(header http.Header, key string) []string {
+	var list []string
+	for _, v := range header.Values(key) {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// X-Forwarded-Proto/Host 取最右边的值，即直接连接的受信任代理写入的值
+func lastValue(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return list[len(list)-1]
+}
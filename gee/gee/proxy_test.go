@@ -0,0 +1,75 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	r := New()
+	if err := r.SetTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetTrustedProxies([]string{"10.0.0.0/8", "not-an-ip"}); err == nil {
+		t.Fatal("invalid proxy should be rejected")
+	}
+	r.SetTrustedProxies([]string{"10.0.0.0/8"})
+
+	cases := []struct {
+		remote  string
+		headers map[string]string
+		client  string
+		scheme  string
+		host    string
+	}{
+		// 对端不受信任时忽略所有代理请求头
+		{"203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Proto": "https"}, "203.0.113.9", "http", "example.com"},
+		// 从右向左跳过受信任的代理，最左边伪造的值不会被采信
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7, 10.0.0.2", "X-Forwarded-Proto": "http, https", "X-Forwarded-Host": "app.example.com"}, "198.51.100.7", "https", "app.example.com"},
+		{"10.0.0.1:80", map[string]string{"X-Real-IP": "198.51.100.8"}, "198.51.100.8", "http", "example.com"},
+		{"10.0.0.1:80", map[string]string{"Forwarded": `for=198.51.100.9;proto=https;host=shop.example.com, for="10.0.0.3:4711";proto=http`}, "198.51.100.9", "https", "shop.example.com"},
+		{"10.0.0.1:80", map[string]string{"Forwarded": `for="[2001:db8::7]:4711"`}, "2001:db8::7", "http", "example.com"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.RemoteAddr = tc.remote
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		c := newContext(httptest.NewRecorder(), req)
+		c.engine = r
+		if got := c.ClientIP(); got != tc.client {
+			t.Errorf("%v: ClientIP = %q, want %q", tc.headers, got, tc.client)
+		}
+		if got := c.Scheme(); got != tc.scheme {
+			t.Errorf("%v: Scheme = %q, want %q", tc.headers, got, tc.scheme)
+		}
+		if got := c.Host(); got != tc.host {
+			t.Errorf("%v: Host = %q, want %q", tc.headers, got, tc.host)
+		}
+	}
+}
+
+func TestTrustedProxyHostRouting(t *testing.T) {
+	r := New()
+	r.SetTrustedProxies([]string{"10.0.0.1"})
+	r.Host("api.example.com").GET("/", func(c *Context) { c.String(http.StatusOK, "api") })
+	r.GET("/", func(c *Context) { c.String(http.StatusOK, "default") })
+
+	req := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	req.Header.Set("X-Forwarded-Host", "api.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "api" {
+		t.Fatalf("host routing should use the forwarded host, got %q", w.Body.String())
+	}
+
+	req.RemoteAddr = "203.0.113.9:5555"
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "default" {
+		t.Fatalf("forwarded host from an untrusted peer should be ignored, got %q", w.Body.String())
+	}
+}
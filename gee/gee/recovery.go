@@ -33,7 +33,7 @@ func Recovery() HandlerFunc {
 			if err := recover(); err != nil {
 				message := fmt.Sprintf("%s", err)
 				fmt.Println("报错开始")
-				log.Printf("Recovery:%s\n\n", trace(message))
+				log.Printf("Recovery:%s%s\n\n", logIDs(c), trace(message))
 				fmt.Println("报错结束")
 				c.Fail(http.StatusInternalServerError, "Internal Server Error")
 			}
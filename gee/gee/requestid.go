@@ -0,0 +1,48 @@
+package gee
+
+import "encoding/hex"
+
+const (
+	HeaderXRequestID = "X-Request-ID"
+	requestIDKey     = "gee/requestID" // 请求ID在 Context.Keys 中的键
+	maxRequestIDLen  = 128             // 上游传入的请求ID超过该长度时重新生成
+)
+
+// RequestID 中间件：优先沿用上游(网关或调用方)传入的 X-Request-ID，没有或不合法时生成一个新的，
+// 保存到 Context 中并通过响应头回显，便于跨服务串联同一请求的日志
+func RequestID() HandlerFunc {
+	return func(c *Context) {
+		id := c.Req.Header.Get(HeaderXRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.SetHeader(HeaderXRequestID, id)
+		c.Next()
+	}
+}
+
+// RequestID 返回当前请求的请求ID，未启用 RequestID 中间件时返回空字符串
+func (c *Context) RequestID() string {
+	return c.GetString(requestIDKey)
+}
+
+// 生成 16 字节随机数的十六进制形式作为请求ID
+func newRequestID() string {
+	var b [16]byte
+	randomBytes(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// 只接受长度合理的可见 ASCII 字符，防止通过请求头向日志中注入换行等内容
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package gee
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// responseWriter 包装 http.ResponseWriter，记录状态码和是否已经写出响应，
+// 使 WrapH 挂载的标准库 Handler 直接写出的状态码也能反映到 Context.StatusCode 上
+type responseWriter struct {
+	http.ResponseWriter
+	ctx     *Context
+	written bool // 响应头是否已经写出
+	size    int  // 已写出的响应体字节数
+	discard bool // 框架已经写出完整的响应(例如 BodyLimit 的 413)，丢弃 Handler 之后写入的内容
+	// 响应头写出前执行的回调，例如会话中间件在这里写入 Set-Cookie
+	beforeWrite []func()
+}
+
+// 执行并清空 beforeWrite 回调，回调中仍然可以修改响应头
+func (w *responseWriter) runBeforeWrite() {
+	hooks := w.beforeWrite
+	w.beforeWrite = nil
+	for i := len(hooks) - 1; i >= 0; i-- { //后注册的先执行，与中间件 Next 之后的执行顺序一致
+		hooks[i]()
+	}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.written {
+		return //忽略重复的 WriteHeader，避免 net/http 打印 superfluous WriteHeader 警告
+	}
+	w.runBeforeWrite()
+	w.written = true
+	w.ctx.StatusCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.discard {
+		return len(data), nil
+	}
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+// Flush 支持流式响应(例如 pprof 的 profile、SSE)
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.written {
+			w.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// Hijack 支持 WebSocket 等需要接管连接的场景
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.written = true
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("gee: response writer does not implement http.Hijacker")
+}
+
+// Unwrap 供 http.ResponseController 访问底层的 ResponseWriter
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Written 判断响应头是否已经写出，写出之后再设置响应头或状态码都不会生效
+func (c *Context) Written() bool {
+	if w, ok := c.Writer.(*responseWriter); ok {
+		return w.written
+	}
+	return c.StatusCode != 0
+}
+
+// 注册在响应头写出前执行的回调；如果 Handler 没有写出任何内容，则在请求处理结束时执行
+func (c *Context) beforeWrite(fn func()) {
+	if w, ok := c.Writer.(*responseWriter); ok && !w.written {
+		w.beforeWrite = append(w.beforeWrite, fn)
+		return
+	}
+	fn()
+}
@@ -2,18 +2,24 @@ package gee
 
 import (
 	"net/http"
+	"path"
 	"strings"
 )
 
 type router struct {
 	roots    map[string]*node //存储每种请求方式的Trie 树根节点
 	handlers map[string]HandlerFunc //存储每种请求方式的 HandlerFunc
+	names    map[string]string      //路由(method-pattern)对应的名称
 }
 
+// 严格模式下用 "/" 作为末尾斜杠对应的路由段，切分后的正常路由段不可能等于它
+const slashMarker = "/"
+
 func newRouter() *router {
 	return &router{
 		roots:    make(map[string]*node),
 		handlers: make(map[string]HandlerFunc),
+		names:    make(map[string]string),
 	}
 }
 
@@ -32,40 +38,87 @@ func parsePattern(pattern string) []string {
 	return parts
 }
 
+// 切分路径：strict 为 true 时，以 / 结尾的路径(根路径和通配符除外)额外追加 slashMarker。
+// 路由树总是按严格模式保存，是否区分末尾的 / 在查找时由 Engine.StrictSlash 决定
+func parse(path string, strict bool) []string {
+	parts := parsePattern(path)
+	if strict && len(parts) > 0 && strings.HasSuffix(path, "/") && parts[len(parts)-1][0] != '*' {
+		parts = append(parts, slashMarker)
+	}
+	return parts
+}
+
+// parse 的逆过程，把路由段重新拼接为以 / 开头的路径
+func joinParts(parts []string) string {
+	if n := len(parts); n > 0 && parts[n-1] == slashMarker {
+		return "/" + strings.Join(parts[:n-1], "/") + "/"
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
 //给结构体增加路由节点
+//可选参数(例如 /users/:id?)只能出现在末尾，从第一个可选参数开始，每种长度的前缀都注册为同一条路由
 func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
-	parts := parsePattern(pattern)
+	parts := parse(pattern, true)
 
 	key := method + "-" + pattern
 	_, ok := r.roots[method]
 	if !ok {
 		r.roots[method] = &node{} //为了使每个roots[method]都成为*node对象，方便调用insert()
 	}
-	r.roots[method].insert(pattern, parts, 0)
+	required := len(parts) //末尾连续的可选参数之前的段数
+	for i := len(parts) - 1; i >= 0 && isOptionalParam(parts[i]); i-- {
+		required = i
+	}
+	for _, part := range parts[:required] {
+		if isOptionalParam(part) {
+			panic("gee: optional param must be at the end of pattern " + pattern)
+		}
+	}
+	for i := required; i <= len(parts); i++ {
+		r.roots[method].insert(pattern, parts[:i], 0, i < len(parts))
+	}
 	r.handlers[key] = handler
 }
 
+func isOptionalParam(part string) bool {
+	if part[0] != ':' {
+		return false
+	}
+	_, _, optional := splitParam(part)
+	return optional
+}
+
 //解析了:和*两种匹配符的参数，返回一个 map
 //例如/p/go/doc匹配到/p/:lang/doc，解析结果为：{lang: "go"}，
 // /static/css/geektutu.css匹配到/static/*filepath，解析结果为{filepath: "css/geektutu.css"}
-func (r *router) getRoute(method string, path string) (*node, map[string]string) {
-	searchParts := parsePattern(path)
+//strict 为 false 时忽略末尾的 /，/hello/ 也能匹配 /hello，反之亦然
+func (r *router) getRoute(method string, path string, strict bool) (*node, map[string]string) {
 	params := make(map[string]string)
 	root, ok := r.roots[method]
 
 	if !ok {
 		return nil, nil
 	}
+	searchParts := parse(path, strict)
 	n := root.search(searchParts, 0) //成功匹配的路由节点
+	if n == nil && !strict && len(searchParts) > 0 {
+		searchParts = append(searchParts, slashMarker) //再尝试以 / 结尾的路由
+		n = root.search(searchParts, 0)
+	}
 	if n != nil {
-		parts := parsePattern(n.pattern) //n.pattern拿到成功匹配到的节点上面的完整路径
+		parts := parse(n.pattern, true) //n.pattern拿到成功匹配到的节点上面的完整路径
 		for index, part := range parts {
+			if index >= len(searchParts) {
+				break //未提供的可选参数
+			}
 			if part[0] == ':' {
-				params[part[1:]] = searchParts[index]
+				name, _, _ := splitParam(part)
+				params[name] = searchParts[index]
 			}
 			if part[0] == '*' && len(part) > 1 {
 				//使len(part) > 1才有可以被赋值的对象
-				params[part[1:]] = strings.Join(searchParts[index:], "/") //将切片以'/'为分隔符组合成一个string
+				params[part[1:]] = strings.TrimPrefix(joinParts(searchParts[index:]), "/") //将切片以'/'为分隔符组合成一个string
 				break
 			}
 		}
@@ -86,12 +139,27 @@ func (r *router) getRoutes(method string) []*node {
 }
 
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
+	engine := c.engine
+	if engine.RemoveExtraSlash {
+		c.Path = cleanPath(c.Path) //合并多余的 /，之后的匹配和参数解析都基于清理后的路径
+	}
+	n, params := r.getRoute(c.Method, c.Path, engine.StrictSlash)
 
-	if n != nil {
+	if target := r.redirectPath(c, n); target != "" {
+		c.handlers = append(c.handlers, func(c *Context) {
+			c.redirectPath(target)
+		})
+	} else if n != nil {
 		key := c.Method + "-" + n.pattern
-		//在调用匹配到的handler前，将解析出来的路由参数赋值给了c.Params
-		c.Params = params
+		//在调用匹配到的handler前，将解析出来的路由参数赋值给了c.Params(与主机名参数合并)
+		if c.Params == nil {
+			c.Params = params
+		} else {
+			for k, v := range params {
+				c.Params[k] = v
+			}
+		}
+		c.Pattern = n.pattern
 		c.handlers = append(c.handlers, r.handlers[key]) //将从路由匹配得到的 Handler 添加到 c.handlers列表中，执行c.Next()
 	} else {
 		c.handlers = append(c.handlers, func(c *Context) {
@@ -100,3 +168,84 @@ func (r *router) handle(c *Context) {
 	}
 	c.Next()
 }
+
+// 根据 Engine 的路径修正选项计算需要重定向到的路径，不需要重定向时返回空字符串
+func (r *router) redirectPath(c *Context, n *node) string {
+	engine := c.engine
+	path := c.Path
+	if n != nil {
+		//已匹配到路由：把请求路径修正为规范形式(清理多余的 /，末尾 / 与路由规则保持一致)
+		target := path
+		if engine.RedirectFixedPath {
+			target = cleanPath(target)
+		}
+		if engine.RedirectTrailingSlash && !engine.StrictSlash && !strings.Contains(n.pattern, "*") && target != "/" {
+			wantSlash := strings.HasSuffix(n.pattern, "/") && n.pattern != "/"
+			if hasSlash := strings.HasSuffix(target, "/"); hasSlash && !wantSlash {
+				target = strings.TrimRight(target, "/")
+			} else if !hasSlash && wantSlash {
+				target += "/"
+			}
+		}
+		if target != path {
+			return target
+		}
+		return ""
+	}
+
+	//未匹配到路由：依次尝试切换末尾的 /、清理路径并忽略大小写查找
+	if engine.RedirectTrailingSlash && engine.StrictSlash && path != "/" {
+		target := toggleTrailingSlash(path)
+		if n, _ := r.getRoute(c.Method, target, true); n != nil {
+			return target
+		}
+	}
+	if engine.RedirectFixedPath {
+		candidates := []string{cleanPath(path)}
+		if engine.RedirectTrailingSlash {
+			candidates = append(candidates, toggleTrailingSlash(candidates[0]))
+		}
+		for _, candidate := range candidates {
+			if fixed, ok := r.findCaseInsensitivePath(c.Method, candidate, engine.StrictSlash); ok && fixed != path {
+				return fixed
+			}
+		}
+	}
+	return ""
+}
+
+// 忽略大小写查找路由，返回按路由规则修正了静态段大小写的路径
+func (r *router) findCaseInsensitivePath(method string, path string, strict bool) (string, bool) {
+	root, ok := r.roots[method]
+	if !ok {
+		return "", false
+	}
+	searchParts := parse(path, strict)
+	parts, ok := root.searchFold(searchParts, 0)
+	if !ok && !strict && len(searchParts) > 0 {
+		parts, ok = root.searchFold(append(searchParts, slashMarker), 0)
+	}
+	if !ok {
+		return "", false
+	}
+	return joinParts(parts), true
+}
+
+func toggleTrailingSlash(path string) string {
+	if strings.HasSuffix(path, "/") {
+		return strings.TrimRight(path, "/")
+	}
+	return path + "/"
+}
+
+// cleanPath 合并多余的 /，处理 . 和 ..，并保留末尾的 /，例如 //a/./b/../c/ 清理为 /a/c/
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
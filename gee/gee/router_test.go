@@ -1,7 +1,10 @@
 package gee
 
 import (
-	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -16,9 +19,318 @@ func newTestRouter() *router {
 }
 func TestGetRoutes(t *testing.T) {
 	r := newTestRouter()
-	fmt.Println("节点信息统计完成")
-	nodes := r.getRoutes("GET")
-	for i, n := range nodes {
-		fmt.Println(i+1, n)
+	var patterns []string
+	for _, n := range r.getRoutes("GET") {
+		patterns = append(patterns, n.pattern)
+	}
+	expect := []string{"/", "/hello/b/c", "/hello/:name", "/hi/:name", "/assets/*filepath"}
+	if !reflect.DeepEqual(patterns, expect) {
+		t.Fatalf("expect %v, got %v", expect, patterns)
+	}
+	if r.getRoutes("POST") != nil {
+		t.Fatalf("no POST routes registered")
+	}
+}
+
+func TestEngineRoutes(t *testing.T) {
+	r := New()
+	r.GET("/hello/:name", handlerForTest)
+	r.POST("/login", handlerForTest)
+	r.GET("/", nil)
+
+	routes := r.Routes()
+	expect := []RouteInfo{
+		{Method: "GET", Path: "/", HandlerName: ""},
+		{Method: "GET", Path: "/hello/:name", HandlerName: "gee.handlerForTest"},
+		{Method: "POST", Path: "/login", HandlerName: "gee.handlerForTest"},
+	}
+	if !reflect.DeepEqual(routes, expect) {
+		t.Fatalf("expect %v, got %v", expect, routes)
+	}
+
+	data, err := r.RoutesJSON()
+	if err != nil || !strings.Contains(string(data), `"handler": "gee.handlerForTest"`) {
+		t.Fatalf("unexpected routes json %s, err %v", data, err)
+	}
+}
+
+func handlerForTest(c *Context) {}
+
+func TestEngineURL(t *testing.T) {
+	r := New()
+	r.GET("/users/:id", handlerForTest).Name("user")
+	r.Group("/v1").POST("/login", handlerForTest).Name("login")
+	r.GET("/assets/*filepath", handlerForTest).Name("assets")
+	r.GET("/posts/:year<uint>/:slug?", handlerForTest).Name("post")
+
+	cases := []struct {
+		name   string
+		params []interface{}
+		expect string
+	}{
+		{"login", nil, "/v1/login"},
+		{"user", []interface{}{"id", 42}, "/users/42"},
+		{"user", []interface{}{"id", "a b?"}, "/users/a%20b%3F"},
+		{"user", []interface{}{"id", 1, "tab", "posts"}, "/users/1?tab=posts"},
+		{"assets", []interface{}{"filepath", "css/gee tutu.css"}, "/assets/css/gee%20tutu.css"},
+		{"post", []interface{}{"year", 2021}, "/posts/2021"},
+		{"post", []interface{}{"year", 2021, "slug", "gee"}, "/posts/2021/gee"},
+	}
+	for _, c := range cases {
+		if got, err := r.URL(c.name, c.params...); err != nil || got != c.expect {
+			t.Errorf("URL(%q, %v) = %q, %v; expect %q", c.name, c.params, got, err, c.expect)
+		}
+	}
+	if _, err := r.URL("user"); err == nil {
+		t.Errorf("missing param should return an error")
+	}
+	if _, err := r.URL("post", "year", "abc"); err == nil {
+		t.Errorf("value violating the constraint should return an error")
+	}
+	if _, err := r.URL("user", "id", "a/b"); err == nil {
+		t.Errorf("param value containing / should return an error")
+	}
+	if _, err := r.URL("unknown"); err == nil {
+		t.Errorf("unknown route should return an error")
+	}
+	if routes := r.Routes(); routes[0].Name != "user" {
+		t.Errorf("route name should appear in Routes(): %v", routes)
+	}
+}
+
+// 生成的路径经过请求解码后应该匹配回原来的路由，并得到原来的参数值
+func TestEngineURLRoundTrip(t *testing.T) {
+	r := New()
+	r.GET("/files/:name", func(c *Context) { c.String(http.StatusOK, "name=%s", c.Param("name")) }).Name("file")
+	r.GET("/assets/*filepath", func(c *Context) { c.String(http.StatusOK, "filepath=%s", c.Param("filepath")) }).Name("assets")
+
+	cases := []struct {
+		name   string
+		params []interface{}
+		expect string
+	}{
+		{"file", []interface{}{"name", "a b?c"}, "name=a b?c"},
+		{"file", []interface{}{"name", "100%"}, "name=100%"},
+		{"assets", []interface{}{"filepath", "css/gee tutu.css"}, "filepath=css/gee tutu.css"},
+	}
+	for _, c := range cases {
+		path, err := r.URL(c.name, c.params...)
+		if err != nil {
+			t.Fatalf("URL(%q, %v): %v", c.name, c.params, err)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != c.expect {
+			t.Errorf("GET %s: got %d %q, expect %q", path, w.Code, w.Body.String(), c.expect)
+		}
+	}
+}
+
+func TestParamConstraints(t *testing.T) {
+	r := newRouter()
+	r.addRoute("GET", "/users/:id<int>", nil)
+	r.addRoute("GET", "/users/:name", nil)
+	r.addRoute("GET", "/users/new", nil)
+	r.addRoute("GET", "/files/:name<[a-z]+\\.txt>", nil)
+	r.addRoute("GET", "/posts/:year<uint>/:slug?", nil)
+
+	cases := []struct {
+		path    string
+		pattern string
+		params  map[string]string
+	}{
+		{"/users/42", "/users/:id<int>", map[string]string{"id": "42"}},
+		{"/users/geektutu", "/users/:name", map[string]string{"name": "geektutu"}},
+		{"/users/new", "/users/new", map[string]string{}},
+		{"/files/readme.txt", "/files/:name<[a-z]+\\.txt>", map[string]string{"name": "readme.txt"}},
+		{"/posts/2021", "/posts/:year<uint>/:slug?", map[string]string{"year": "2021"}},
+		{"/posts/2021/gee", "/posts/:year<uint>/:slug?", map[string]string{"year": "2021", "slug": "gee"}},
+	}
+	for _, c := range cases {
+		n, params := r.getRoute("GET", c.path, false)
+		if n == nil || n.pattern != c.pattern || !reflect.DeepEqual(params, c.params) {
+			t.Errorf("%s: expect %s %v, got %v %v", c.path, c.pattern, c.params, n, params)
+		}
+	}
+	for _, path := range []string{"/files/README.md", "/posts/-1", "/posts/abc/gee"} {
+		if n, _ := r.getRoute("GET", path, false); n != nil {
+			t.Errorf("%s should not match, got %v", path, n)
+		}
+	}
+
+	//可选参数的每种前缀只对应一条路由
+	count := 0
+	for _, n := range r.getRoutes("GET") {
+		if n.pattern == "/posts/:year<uint>/:slug?" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("optional route should be listed once, got %d", count)
+	}
+}
+
+func TestOptionalParamConflict(t *testing.T) {
+	for _, patterns := range [][]string{
+		{"/a", "/a/:b?"},
+		{"/a/:b?", "/a"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v: conflicting routes should panic", patterns)
+				}
+			}()
+			r := newRouter()
+			for _, pattern := range patterns {
+				r.addRoute("GET", pattern, nil)
+			}
+		}()
+	}
+}
+
+func TestTypedParams(t *testing.T) {
+	c := &Context{Params: map[string]string{
+		"id":   "42",
+		"neg":  "-1",
+		"uuid": "6BA7B810-9DAD-11D1-80B4-00C04FD430C8",
+	}}
+	if id, err := c.ParamInt("id"); err != nil || id != 42 {
+		t.Errorf("ParamInt: %v %v", id, err)
+	}
+	if _, err := c.ParamUint64("neg"); err == nil {
+		t.Errorf("ParamUint64 should reject negative numbers")
+	}
+	if _, err := c.ParamInt("missing"); err == nil {
+		t.Errorf("missing param should return an error")
+	}
+	if id, err := c.ParamUUID("uuid"); err != nil || id != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Errorf("ParamUUID: %v %v", id, err)
+	}
+	if _, err := c.ParamUUID("id"); err == nil {
+		t.Errorf("ParamUUID should reject %q", c.Params["id"])
+	}
+}
+
+func TestHostRouting(t *testing.T) {
+	r := New()
+	var trace []string
+	r.Use(func(c *Context) { trace = append(trace, "global") })
+	r.GET("/", func(c *Context) { c.String(http.StatusOK, "default") })
+
+	api := r.Host("api.example.com")
+	api.Use(func(c *Context) { trace = append(trace, "api") })
+	api.GET("/", func(c *Context) { c.String(http.StatusOK, "api") })
+
+	tenant := r.Host(":tenant.example.com").Group("/v1")
+	tenant.GET("/users/:id", func(c *Context) {
+		c.String(http.StatusOK, "%s/%s", c.Param("tenant"), c.Param("id"))
+	})
+
+	cases := []struct {
+		host, path, body string
+		trace            []string
+	}{
+		{"api.example.com:8000", "/", "api", []string{"global", "api"}},
+		{"ACME.example.com", "/v1/users/42", "acme/42", []string{"global"}},
+		{"localhost", "/", "default", []string{"global"}},
+	}
+	for _, c := range cases {
+		trace = nil
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Host = c.host
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Body.String() != c.body || !reflect.DeepEqual(trace, c.trace) {
+			t.Errorf("%s%s: expect %q %v, got %q %v", c.host, c.path, c.body, c.trace, w.Body.String(), trace)
+		}
+	}
+
+	//主机拥有独立的路由树，默认路由树中的路由不会被其他主机访问到
+	req := httptest.NewRequest("GET", "/v1/users/42", nil)
+	req.Host = "api.example.com"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expect 404, got %d", w.Code)
+	}
+	if routes := r.Routes(); len(routes) != 3 || routes[2].Host != ":tenant.example.com" {
+		t.Errorf("unexpected routes %v", routes)
+	}
+}
+
+func TestPathRedirects(t *testing.T) {
+	newEngine := func(setup func(r *Engine)) *Engine {
+		r := New()
+		setup(r)
+		r.GET("/hello", func(c *Context) { c.String(http.StatusOK, "hello") })
+		r.GET("/dir/", func(c *Context) { c.String(http.StatusOK, "dir") })
+		r.POST("/login", func(c *Context) { c.String(http.StatusOK, "login") })
+		r.GET("/assets/*filepath", func(c *Context) { c.String(http.StatusOK, c.Param("filepath")) })
+		return r
+	}
+	do := func(r *Engine, method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	lenient := newEngine(func(r *Engine) { r.RedirectTrailingSlash = true; r.RedirectFixedPath = true })
+	cases := []struct {
+		method, target string
+		code           int
+		location       string
+	}{
+		{"GET", "/hello/?a=1", http.StatusMovedPermanently, "/hello?a=1"},
+		{"GET", "/dir", http.StatusMovedPermanently, "/dir/"},
+		{"POST", "/login/", http.StatusPermanentRedirect, "/login"},
+		{"GET", "//hello", http.StatusMovedPermanently, "/hello"},
+		{"GET", "/HeLLo", http.StatusMovedPermanently, "/hello"},
+		{"GET", "/hello", http.StatusOK, ""},
+		{"GET", "/nothing", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		w := do(lenient, c.method, c.target)
+		if w.Code != c.code || w.Header().Get("Location") != c.location {
+			t.Errorf("%s %s: expect %d %q, got %d %q", c.method, c.target, c.code, c.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	strict := newEngine(func(r *Engine) { r.StrictSlash = true })
+	if w := do(strict, "GET", "/hello/"); w.Code != http.StatusNotFound {
+		t.Errorf("strict mode should distinguish trailing slash, got %d", w.Code)
+	}
+	if w := do(strict, "GET", "/dir/"); w.Body.String() != "dir" {
+		t.Errorf("expect dir, got %q", w.Body.String())
+	}
+	if w := do(strict, "GET", "/assets/css/"); w.Body.String() != "css/" {
+		t.Errorf("catch-all should keep the trailing slash, got %q", w.Body.String())
+	}
+	strict.RedirectTrailingSlash = true
+	if w := do(strict, "GET", "/dir"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/dir/" {
+		t.Errorf("expect redirect to /dir/, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	//注册路由之后修改 StrictSlash 同样生效
+	lenient.StrictSlash = true
+	lenient.RedirectTrailingSlash = false
+	if w := do(lenient, "GET", "/hello/"); w.Code != http.StatusNotFound {
+		t.Errorf("StrictSlash set after registration should apply, got %d", w.Code)
+	}
+	lenient.StrictSlash = false
+	if w := do(lenient, "GET", "/dir"); w.Body.String() != "dir" {
+		t.Errorf("expect dir, got %d %q", w.Code, w.Body.String())
+	}
+
+	//Location 使用转义后的路径
+	fixed := newEngine(func(r *Engine) { r.RedirectFixedPath = true })
+	fixed.GET("/files/:name", func(c *Context) {})
+	if w := do(fixed, "GET", "/FILES/a%20b%3Fc"); w.Header().Get("Location") != "/files/a%20b%3Fc" {
+		t.Errorf("redirect location should be escaped, got %q", w.Header().Get("Location"))
+	}
+
+	clean := newEngine(func(r *Engine) { r.RemoveExtraSlash = true })
+	if w := do(clean, "GET", "/assets//css///gee.css"); w.Body.String() != "css/gee.css" {
+		t.Errorf("extra slashes should be removed, got %q", w.Body.String())
 	}
 }
@@ -0,0 +1,76 @@
+package gee
+
+import (
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+// RouteInfo 描述一条已注册的路由
+type RouteInfo struct {
+	Host        string `json:"host,omitempty"` //通过 Engine.Host 注册的路由所属主机
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Name        string `json:"name,omitempty"` //通过 Route.Name 设置的路由名称
+	HandlerName string `json:"handler"`        //通过 runtime 解析出的处理函数全名，例如 main.main.func1
+}
+
+// Routes 返回所有已注册的路由，先列出默认路由树，再按注册顺序列出各主机的路由；
+// 同一棵路由树内按请求方法排序，同一方法内按路由树的遍历顺序排列
+func (engine *Engine) Routes() []RouteInfo {
+	routes := engine.router.routes()
+	for _, h := range engine.hosts {
+		for _, route := range h.router.routes() {
+			route.Host = h.pattern
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// RoutesJSON 以 JSON 格式导出路由表，可用于生成 API 网关等外部系统的配置
+func (engine *Engine) RoutesJSON() ([]byte, error) {
+	return json.MarshalIndent(engine.Routes(), "", "  ")
+}
+
+func (r *router) routes() []RouteInfo {
+	methods := make([]string, 0, len(r.roots))
+	for method := range r.roots {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	routes := make([]RouteInfo, 0, len(r.handlers))
+	for _, method := range methods {
+		for _, n := range r.getRoutes(method) {
+			key := method + "-" + n.pattern
+			routes = append(routes, RouteInfo{
+				Method:      method,
+				Path:        n.pattern,
+				Name:        r.names[key],
+				HandlerName: nameOfFunction(r.handlers[key]),
+			})
+		}
+	}
+	return routes
+}
+
+// 启动时在 debug 模式下打印路由表
+func debugPrintRoutes(routes []RouteInfo) {
+	for _, route := range routes {
+		debugPrint("%-6s %-25s --> %s", route.Method, route.Host+route.Path, route.HandlerName)
+	}
+}
+
+// 通过函数指针在运行时查找函数名
+func nameOfFunction(f interface{}) string {
+	v := reflect.ValueOf(f)
+	if !v.IsValid() || v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
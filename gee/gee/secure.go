@@ -0,0 +1,160 @@
+package gee
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	cspNonceKey = "gee/cspNonce" // 当前请求的 CSP nonce 在 Context.Keys 中的键
+	// CSPNoncePlaceholder 是 ContentSecurityPolicy 中的占位符，每个请求替换为新生成的 nonce
+	CSPNoncePlaceholder = "$NONCE"
+)
+
+// SecureConfig 是 Secure 中间件的配置，零值字段表示不设置对应的响应头或不启用对应的检查
+type SecureConfig struct {
+	// AllowedHosts 是允许访问的域名，为空时不限制；以 *. 开头时匹配所有子域名，例如 *.example.com
+	AllowedHosts []string
+	// SSLRedirect 把 HTTP 请求重定向到 HTTPS，重定向地址使用请求的域名，建议同时配置 AllowedHosts
+	SSLRedirect bool
+	// SSLHost 是重定向使用的域名，为空时使用请求的域名
+	SSLHost string
+
+	STSSeconds           int64 // Strict-Transport-Security 的 max-age，为 0 时不设置
+	STSIncludeSubdomains bool
+	STSPreload           bool
+	// ForceSTSHeader 在 HTTP 请求中也设置 HSTS，默认只在 HTTPS 请求中设置(规范要求浏览器忽略 HTTP 响应中的 HSTS)
+	ForceSTSHeader bool
+
+	ContentTypeNosniff bool   // X-Content-Type-Options: nosniff
+	FrameOptions       string // X-Frame-Options，DENY 或 SAMEORIGIN
+	ReferrerPolicy     string
+	PermissionsPolicy  string
+	// ContentSecurityPolicy 中的 $NONCE 会替换为每个请求的随机 nonce，
+	// 模板中通过 {{cspNonce}} 输出，例如 <script nonce="{{cspNonce}}">
+	ContentSecurityPolicy string
+	CSPReportOnly         bool // 使用 Content-Security-Policy-Report-Only，只上报不拦截
+
+	// BadHostHandler 处理域名不在 AllowedHosts 中的请求，默认返回 400
+	BadHostHandler HandlerFunc
+}
+
+// DefaultSecureConfig 是适合大多数 HTTPS 站点的配置：HSTS 一年，禁止被嵌入 frame，
+// 脚本和样式只允许同源或携带 nonce 的内联代码
+var DefaultSecureConfig = SecureConfig{
+	SSLRedirect:           true,
+	STSSeconds:            365 * 24 * 60 * 60,
+	STSIncludeSubdomains:  true,
+	ContentTypeNosniff:    true,
+	FrameOptions:          "DENY",
+	ReferrerPolicy:        "strict-origin-when-cross-origin",
+	PermissionsPolicy:     "camera=(), microphone=(), geolocation=()",
+	ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-$NONCE'; style-src 'self' 'nonce-$NONCE'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+}
+
+// Secure 中间件依次检查请求域名、把 HTTP 请求重定向到 HTTPS，然后设置各项安全相关的响应头
+func Secure(config SecureConfig) HandlerFunc {
+	if config.BadHostHandler == nil {
+		config.BadHostHandler = func(c *Context) {
+			c.Fail(http.StatusBadRequest, "Bad Host")
+		}
+	}
+	sts := ""
+	if config.STSSeconds > 0 {
+		sts = "max-age=" + strconv.FormatInt(config.STSSeconds, 10)
+		if config.STSIncludeSubdomains {
+			sts += "; includeSubDomains"
+		}
+		if config.STSPreload {
+			sts += "; preload"
+		}
+	}
+	cspHeader := "Content-Security-Policy"
+	if config.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	useNonce := strings.Contains(config.ContentSecurityPolicy, CSPNoncePlaceholder)
+
+	return func(c *Context) {
+		host := c.Host() //代理请求头按 Engine.SetTrustedProxies 采信，与 ClientIP 使用相同的信任设置
+		if len(config.AllowedHosts) > 0 && !hostAllowed(host, config.AllowedHosts) {
+			config.BadHostHandler(c)
+			c.Abort()
+			return
+		}
+		isSSL := c.Scheme() == "https"
+		if config.SSLRedirect && !isSSL {
+			if config.SSLHost != "" {
+				host = config.SSLHost
+			}
+			code := http.StatusMovedPermanently
+			if c.Method != http.MethodGet && c.Method != http.MethodHead {
+				code = http.StatusPermanentRedirect
+			}
+			c.Redirect(code, "https://"+host+c.Req.URL.RequestURI())
+			c.Abort()
+			return
+		}
+
+		header := c.Writer.Header()
+		if sts != "" && (isSSL || config.ForceSTSHeader) {
+			header.Set("Strict-Transport-Security", sts)
+		}
+		if config.ContentTypeNosniff {
+			header.Set("X-Content-Type-Options", "nosniff")
+		}
+		if config.FrameOptions != "" {
+			header.Set("X-Frame-Options", config.FrameOptions)
+		}
+		if config.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", config.ReferrerPolicy)
+		}
+		if config.PermissionsPolicy != "" {
+			header.Set("Permissions-Policy", config.PermissionsPolicy)
+		}
+		if config.ContentSecurityPolicy != "" {
+			csp := config.ContentSecurityPolicy
+			if useNonce {
+				nonce := newCSPNonce()
+				c.Set(cspNonceKey, nonce)
+				c.setTemplateValue("cspNonce", nonce)
+				csp = strings.Replace(csp, CSPNoncePlaceholder, nonce, -1)
+			}
+			header.Set(cspHeader, csp)
+		}
+		c.Next()
+	}
+}
+
+// CSPNonce 返回当前请求的 CSP nonce，未启用 Secure 中间件或策略中没有 $NONCE 时返回空字符串
+func (c *Context) CSPNonce() string {
+	return c.GetString(cspNonceKey)
+}
+
+// 比较时忽略端口和大小写
+func hostAllowed(host string, allowed []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// CSP 允许 base64url 形式的 nonce，它不包含 + 和 /，在 HTML 属性中无需转义
+func newCSPNonce() string {
+	var b [16]byte
+	randomBytes(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
@@ -0,0 +1,88 @@
+package gee_test
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"gee"
+	"gee/geetest"
+)
+
+func TestSecure(t *testing.T) {
+	config := gee.DefaultSecureConfig
+	config.AllowedHosts = []string{"example.com", "*.example.org"}
+
+	r := gee.New()
+	r.SetHTMLTemplate(template.Must(r.NewTemplate("page.tmpl").Parse(`<script nonce="{{cspNonce}}">1</script>`)))
+	r.Use(gee.Secure(config))
+	r.GET("/page", func(c *gee.Context) { c.HTML(http.StatusOK, "page.tmpl", nil) })
+	r.POST("/form", func(c *gee.Context) { c.String(http.StatusOK, "ok") })
+	r.SSLProxyHeaders = map[string]string{"X-Forwarded-SSL": "on"}
+	client := geetest.New(t, r)
+
+	//对端不是受信任的代理时，伪造的代理请求头既不能绕过 AllowedHosts，也不能跳过 HTTPS 重定向
+	client.GET("/page").Header("X-Forwarded-Proto", "https").Do().Status(http.StatusMovedPermanently)
+	client.GET("/page").Header("X-Forwarded-SSL", "on").Do().Status(http.StatusMovedPermanently)
+	client.GET("http://evil.com/page").Header("X-Forwarded-Host", "example.com").Do().Status(http.StatusBadRequest)
+	r.SetTrustedProxies([]string{"192.0.2.1"}) //geetest 请求的 RemoteAddr
+	client.GET("/page").Header("X-Forwarded-SSL", "on").Do().Status(http.StatusOK)
+
+	client.GET("/page?a=1").Do().Status(http.StatusMovedPermanently).
+		Header("Location", "https://example.com/page?a=1")
+	client.POST("/form").Do().Status(http.StatusPermanentRedirect)
+	client.GET("/page").Header("X-Forwarded-Proto", "https").Header("X-Forwarded-Host", "evil.com").Do().
+		Status(http.StatusBadRequest)
+	client.GET("/page").Header("X-Forwarded-Proto", "https").Header("X-Forwarded-Host", "api.example.org:8443").Do().
+		Status(http.StatusOK)
+
+	resp := client.GET("/page").Header("X-Forwarded-Proto", "https").Do().Status(http.StatusOK).
+		Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains").
+		Header("X-Content-Type-Options", "nosniff").
+		Header("X-Frame-Options", "DENY").
+		Header("Referrer-Policy", "strict-origin-when-cross-origin")
+	csp := resp.Recorder.Header().Get("Content-Security-Policy")
+	m := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(resp.BodyString())
+	if m == nil || m[1] == "" {
+		t.Fatalf("cspNonce should render the request nonce, got %q", resp.BodyString())
+	}
+	if !strings.Contains(csp, "'nonce-"+m[1]+"'") || strings.Contains(csp, gee.CSPNoncePlaceholder) {
+		t.Fatalf("CSP should carry the same nonce as the template, got %q", csp)
+	}
+	next := client.GET("/page").Header("X-Forwarded-Proto", "https").Do().BodyString()
+	if next == resp.BodyString() {
+		t.Fatalf("nonce should change for every request")
+	}
+}
+
+// 并发渲染时每个请求读到的都是自己的 nonce
+func TestSecureNonceConcurrent(t *testing.T) {
+	config := gee.DefaultSecureConfig
+	config.SSLRedirect = false
+	r := gee.New()
+	r.SetHTMLTemplate(template.Must(r.NewTemplate("page.tmpl").Parse(`<script nonce="{{cspNonce}}">1</script>`)))
+	r.Use(gee.Secure(config))
+	r.GET("/page", func(c *gee.Context) { c.HTML(http.StatusOK, "page.tmpl", nil) })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", "/page", nil))
+				m := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(w.Body.String())
+				if m == nil || !strings.Contains(w.Header().Get("Content-Security-Policy"), "'nonce-"+m[1]+"'") {
+					t.Errorf("template nonce does not match the CSP header: %q", w.Body.String())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,373 @@
+package gee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionKey = "gee/session" // 当前请求的 Session 在 Context.Keys 中的键
+	flashKey   = "_flash"      // 闪现消息保存在 Session.Values 中的键
+	// 会话 Cookie 的默认名称，可以通过 CookieStore.Name、MemoryStore.Name 修改
+	defaultSessionName = "gee_session"
+	// 会话默认有效期 30 天
+	defaultSessionMaxAge = 30 * 24 * 60 * 60
+)
+
+var (
+	ErrInvalidSession = errors.New("gee: session cookie is invalid")
+	ErrSessionExpired = errors.New("gee: session cookie has expired")
+)
+
+// Session 是一次会话的数据。修改过的 Session 会在响应头写出前自动保存
+type Session struct {
+	ID     string
+	Values map[string]interface{}
+	IsNew  bool // 请求中没有有效的会话 Cookie，本次新建
+
+	name      string
+	modified  bool
+	destroyed bool
+	oldID     string // RegenerateID 之前的 ID，保存时由服务端存储删除
+}
+
+func newSession(name string) *Session {
+	return &Session{ID: newSessionID(), Values: make(map[string]interface{}), IsNew: true, name: name}
+}
+
+func (s *Session) Name() string { return s.name }
+
+func (s *Session) Get(key string) interface{} {
+	return s.Values[key]
+}
+
+func (s *Session) Set(key string, value interface{}) {
+	s.Values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.Values, key)
+	s.modified = true
+}
+
+// Clear 清空会话中的所有数据
+func (s *Session) Clear() {
+	s.Values = make(map[string]interface{})
+	s.modified = true
+}
+
+// AddFlash 添加一条闪现消息，它只会被之后的 Flashes 读取一次，常用于重定向后提示"登录成功"之类的信息
+func (s *Session) AddFlash(value interface{}) {
+	flashes, _ := s.Values[flashKey].([]interface{})
+	s.Values[flashKey] = append(flashes, value)
+	s.modified = true
+}
+
+// Flashes 返回并清除所有闪现消息
+func (s *Session) Flashes() []interface{} {
+	flashes, _ := s.Values[flashKey].([]interface{})
+	if flashes != nil {
+		delete(s.Values, flashKey)
+		s.modified = true
+	}
+	return flashes
+}
+
+// RegenerateID 更换会话ID并保留数据，登录等权限变化时调用以防止会话固定攻击
+func (s *Session) RegenerateID() {
+	if s.oldID == "" {
+		s.oldID = s.ID
+	}
+	s.ID = newSessionID()
+	s.modified = true
+}
+
+// Destroy 删除会话，保存时清除 Cookie 和服务端数据，常用于退出登录
+func (s *Session) Destroy() {
+	s.Values = make(map[string]interface{})
+	s.destroyed = true
+	s.modified = true
+}
+
+// Store 负责会话的读取和保存，会话 Cookie 的名称和属性由 Store 决定
+type Store interface {
+	// Load 读取请求中的会话，没有会话时返回新建的 Session；
+	// Cookie 被篡改或已过期时返回新建的 Session 和对应的错误
+	Load(c *Context) (*Session, error)
+	// Save 保存会话并写入 Cookie，在响应头写出之前调用
+	Save(c *Context, s *Session) error
+}
+
+// Sessions 中间件为每个请求从 store 加载会话，通过 c.Session() 访问；
+// 会话被修改时，在响应头写出前自动保存
+func Sessions(store Store) HandlerFunc {
+	return func(c *Context) {
+		s, err := store.Load(c)
+		if s == nil {
+			s = newSession(defaultSessionName)
+		}
+		name := s.Name()
+		if err != nil && !errors.Is(err, ErrSessionExpired) {
+			log.Printf("[Sessions] %s: %v%s", name, err, logIDs(c))
+		}
+		c.Set(sessionKey, s)
+		c.beforeWrite(func() {
+			if !s.modified {
+				return
+			}
+			if err := store.Save(c, s); err != nil {
+				log.Printf("[Sessions] saving %s: %v%s", name, err, logIDs(c))
+			}
+		})
+		c.Next()
+	}
+}
+
+// Session 返回当前请求的会话，未启用 Sessions 中间件时返回 nil
+func (c *Context) Session() *Session {
+	if v, ok := c.Get(sessionKey); ok {
+		s, _ := v.(*Session)
+		return s
+	}
+	return nil
+}
+
+func newSessionID() string {
+	var b [32]byte
+	randomBytes(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// 会话 Cookie 的属性：默认 30 天有效、HttpOnly、SameSite=Lax
+func defaultSessionOptions() CookieOptions {
+	opts := DefaultCookieOptions
+	opts.MaxAge = defaultSessionMaxAge
+	return opts
+}
+
+// CookieStore 把会话数据整个保存在客户端 Cookie 中：数据以 JSON 编码，
+// 使用 AES-GCM 加密(提供 blockKey 时)，再用 HMAC-SHA256 签名防止篡改。
+// JSON 编码意味着数字读回来是 float64，Cookie 大小限制在 4KB 左右，只适合保存少量数据
+type CookieStore struct {
+	Name    string // 会话 Cookie 的名称，默认 gee_session
+	Options CookieOptions
+	hashKey []byte
+	aead    cipher.AEAD
+	now     func() time.Time
+}
+
+// cookie 中保存的内容
+type cookiePayload struct {
+	ID        string                 `json:"id"`
+	Values    map[string]interface{} `json:"v"`
+	Timestamp int64                  `json:"t"`
+}
+
+// NewCookieStore 创建 Cookie 存储。hashKey 用于签名，建议 32 或 64 字节；
+// blockKey 用于加密，长度必须是 16、24 或 32 字节(对应 AES-128/192/256)，为 nil 时只签名不加密
+func NewCookieStore(hashKey, blockKey []byte) *CookieStore {
+	if len(hashKey) == 0 {
+		panic("gee: cookie store requires a hash key")
+	}
+	s := &CookieStore{Name: defaultSessionName, Options: defaultSessionOptions(), hashKey: hashKey, now: time.Now}
+	if blockKey != nil {
+		block, err := aes.NewCipher(blockKey)
+		if err != nil {
+			panic("gee: cookie store block key: " + err.Error())
+		}
+		if s.aead, err = cipher.NewGCM(block); err != nil {
+			panic("gee: cookie store block key: " + err.Error())
+		}
+	}
+	return s
+}
+
+func (s *CookieStore) Load(c *Context) (*Session, error) {
+	name := s.Name
+	value, err := c.Cookie(name)
+	if err != nil {
+		return newSession(name), nil
+	}
+	payload, err := s.decode(name, value)
+	if err != nil {
+		return newSession(name), err
+	}
+	if payload.Values == nil {
+		payload.Values = make(map[string]interface{})
+	}
+	return &Session{ID: payload.ID, Values: payload.Values, name: name}, nil
+}
+
+func (s *CookieStore) Save(c *Context, session *Session) error {
+	if session.destroyed {
+		c.DeleteCookie(session.name, &s.Options)
+		return nil
+	}
+	value, err := s.encode(session.name, &cookiePayload{ID: session.ID, Values: session.Values, Timestamp: s.now().Unix()})
+	if err != nil {
+		return err
+	}
+	c.SetCookie(session.name, value, &s.Options)
+	return nil
+}
+
+// 编码格式：base64(数据).base64(HMAC(name|数据))，加密时数据为 nonce+密文，name 作为附加数据参与认证
+func (s *CookieStore) encode(name string, payload *cookiePayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		randomBytes(nonce)
+		data = s.aead.Seal(nonce, nonce, data, []byte(name))
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(name, encoded)), nil
+}
+
+func (s *CookieStore) decode(name, value string) (*cookiePayload, error) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return nil, ErrInvalidSession
+	}
+	encoded := value[:i]
+	sum, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil || !hmac.Equal(sum, s.mac(name, encoded)) {
+		return nil, ErrInvalidSession
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	if s.aead != nil {
+		n := s.aead.NonceSize()
+		if len(data) < n {
+			return nil, ErrInvalidSession
+		}
+		if data, err = s.aead.Open(nil, data[:n], data[n:], []byte(name)); err != nil {
+			return nil, ErrInvalidSession
+		}
+	}
+	payload := new(cookiePayload)
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, ErrInvalidSession
+	}
+	if s.Options.MaxAge > 0 && s.now().Unix()-payload.Timestamp > int64(s.Options.MaxAge) {
+		return nil, ErrSessionExpired
+	}
+	return payload, nil
+}
+
+func (s *CookieStore) mac(name, value string) []byte {
+	h := hmac.New(sha256.New, s.hashKey)
+	h.Write([]byte(name + "|" + value))
+	return h.Sum(nil)
+}
+
+// MemoryStore 把会话数据保存在服务端内存中，Cookie 中只保存随机的会话ID。
+// 数据不会在多个进程间共享，进程重启后会话失效
+type MemoryStore struct {
+	Name     string // 会话 Cookie 的名称，默认 gee_session
+	Options  CookieOptions
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	now      func() time.Time
+	lastGC   time.Time
+}
+
+type memorySession struct {
+	values  map[string]interface{}
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Name:     defaultSessionName,
+		Options:  defaultSessionOptions(),
+		sessions: make(map[string]memorySession),
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryStore) Load(c *Context) (*Session, error) {
+	name := s.Name
+	id, err := c.Cookie(name)
+	if err != nil {
+		return newSession(name), nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.sessions[id]
+	if !ok {
+		return newSession(name), nil
+	}
+	if s.now().After(stored.expires) {
+		delete(s.sessions, id)
+		return newSession(name), ErrSessionExpired
+	}
+	return &Session{ID: id, Values: copyValues(stored.values), name: name}, nil
+}
+
+func (s *MemoryStore) Save(c *Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session.oldID != "" {
+		delete(s.sessions, session.oldID)
+		session.oldID = ""
+	}
+	if session.destroyed {
+		delete(s.sessions, session.ID)
+		c.DeleteCookie(session.name, &s.Options)
+		return nil
+	}
+	now := s.now()
+	maxAge := s.Options.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultSessionMaxAge // 会话 Cookie 也需要在服务端设置过期时间，避免数据无限堆积
+	}
+	s.sessions[session.ID] = memorySession{
+		values:  copyValues(session.Values),
+		expires: now.Add(time.Duration(maxAge) * time.Second),
+	}
+	s.gc(now)
+	c.SetCookie(session.name, session.ID, &s.Options)
+	return nil
+}
+
+// 每分钟最多清理一次过期会话
+func (s *MemoryStore) gc(now time.Time) {
+	if now.Sub(s.lastGC) < time.Minute {
+		return
+	}
+	s.lastGC = now
+	for id, stored := range s.sessions {
+		if now.After(stored.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// 浅拷贝，避免并发请求共享同一个 map
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
+
+var (
+	_ Store = (*CookieStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
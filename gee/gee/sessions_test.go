@@ -0,0 +1,81 @@
+package gee_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"gee"
+	"gee/geetest"
+)
+
+func newSessionEngine(store gee.Store) *gee.Engine {
+	r := gee.New()
+	r.Use(gee.Sessions(store))
+	r.POST("/login", func(c *gee.Context) {
+		s := c.Session()
+		s.RegenerateID()
+		s.Set("user", c.PostForm("username"))
+		s.AddFlash("welcome")
+		c.String(http.StatusOK, s.ID)
+	})
+	r.GET("/me", func(c *gee.Context) {
+		s := c.Session()
+		c.JSON(http.StatusOK, gee.H{"user": s.Get("user"), "flashes": s.Flashes(), "id": s.ID})
+	})
+	r.POST("/logout", func(c *gee.Context) {
+		c.Session().Destroy()
+	})
+	return r
+}
+
+func TestSessionStores(t *testing.T) {
+	stores := map[string]gee.Store{
+		"cookie": gee.NewCookieStore([]byte("hash-key-for-testing-0123456789"), []byte("0123456789abcdef")),
+		"memory": gee.NewMemoryStore(),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			client := geetest.New(t, newSessionEngine(store))
+			first := client.GET("/me").Do().JSONPath("user", nil)
+			if first.Cookie("gee_session") != nil {
+				t.Fatalf("unmodified session should not be saved")
+			}
+
+			login := client.POST("/login").Body("application/x-www-form-urlencoded", []byte("username=geektutu")).Do()
+			cookie := login.Cookie("gee_session")
+			if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Fatalf("session cookie should be set with secure defaults: %v", cookie)
+			}
+			if name == "cookie" && strings.Contains(cookie.Value, "geektutu") {
+				t.Fatalf("cookie store should encrypt values: %s", cookie.Value)
+			}
+
+			client.GET("/me").Do().
+				JSONPath("user", "geektutu").
+				JSONPath("flashes", []string{"welcome"}).
+				JSONPath("id", login.BodyString())
+			client.GET("/me").Do().JSONPath("flashes", nil) //闪现消息只能读取一次
+
+			tampered := &http.Cookie{Name: "gee_session", Value: cookie.Value[:len(cookie.Value)-2] + "xx"}
+			geetest.New(t, newSessionEngine(store)).GET("/me").Cookie(tampered).Do().JSONPath("user", nil)
+
+			logout := client.POST("/logout").Do()
+			if c := logout.Cookie("gee_session"); c == nil || c.MaxAge >= 0 {
+				t.Fatalf("logout should delete the session cookie: %v", c)
+			}
+			client.GET("/me").Do().JSONPath("user", nil)
+		})
+	}
+}
+
+func TestSessionCookieName(t *testing.T) {
+	store := gee.NewMemoryStore()
+	store.Name = "sid"
+	client := geetest.New(t, newSessionEngine(store))
+	login := client.POST("/login").Body("application/x-www-form-urlencoded", []byte("username=geektutu")).Do()
+	if login.Cookie("sid") == nil || login.Cookie("gee_session") != nil {
+		t.Fatalf("session cookie should use the store's name")
+	}
+	client.GET("/me").Do().JSONPath("user", "geektutu")
+}
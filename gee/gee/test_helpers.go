@@ -0,0 +1,20 @@
+package gee
+
+import "net/http"
+
+// CreateTestContext 创建一个独立的 Context 和 Engine，用于单独测试某个 Handler 或中间件：
+//
+//	w := httptest.NewRecorder()
+//	c, _ := gee.CreateTestContext(w, httptest.NewRequest("GET", "/hello", nil))
+//	handler(c)
+//
+// req 为 nil 时使用 GET / 请求。Context 中没有后续 Handler，中间件里调用 c.Next() 会直接返回
+func CreateTestContext(w http.ResponseWriter, req *http.Request) (*Context, *Engine) {
+	if req == nil {
+		req, _ = http.NewRequest(http.MethodGet, "/", nil)
+	}
+	engine := New()
+	c := newContext(w, req)
+	c.engine = engine
+	return c, engine
+}
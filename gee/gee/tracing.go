@@ -0,0 +1,258 @@
+package gee
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C Trace Context(https://www.w3.org/TR/trace-context/)定义的两个传播头
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+	spanKey           = "gee/span" // 当前请求的 Span 在 Context.Keys 中的键
+	maxTracestateLen  = 512        // 规范建议至少传播 512 字节，超出部分直接丢弃
+)
+
+var errInvalidTraceparent = errors.New("gee: invalid traceparent header")
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// 全 0 的 trace-id / parent-id 在规范中是非法值
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext 是需要跨服务传播的追踪信息，对应 traceparent 与 tracestate 两个请求头
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte   // trace-flags，最低位表示是否采样
+	TraceState string // 原样透传的 tracestate
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+func (sc SpanContext) IsSampled() bool { return sc.Flags&0x01 == 0x01 }
+
+// Traceparent 按 version-traceid-parentid-flags 的格式编码，例如
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent 解析 traceparent 请求头。
+// 对于高于 00 的版本，只要求前四段格式正确，后面追加的字段忽略(规范要求的向前兼容)
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	value = strings.TrimSpace(value)
+	if len(value) < 55 {
+		return sc, errInvalidTraceparent
+	}
+	version, err := hex.DecodeString(value[0:2])
+	if err != nil || version[0] == 0xff || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, errInvalidTraceparent
+	}
+	if version[0] == 0x00 && len(value) != 55 {
+		return sc, errInvalidTraceparent
+	}
+	if len(value) > 55 && value[55] != '-' {
+		return sc, errInvalidTraceparent
+	}
+	if !decodeLowerHex(sc.TraceID[:], value[3:35]) || !decodeLowerHex(sc.SpanID[:], value[36:52]) {
+		return sc, errInvalidTraceparent
+	}
+	var flags [1]byte
+	if !decodeLowerHex(flags[:], value[53:55]) {
+		return sc, errInvalidTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// 规范只允许小写十六进制
+func decodeLowerHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// 校验 tracestate 的成员格式(key=value，以逗号分隔，最多 32 个)，不合法时整个丢弃
+func parseTracestate(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" || len(value) > maxTracestateLen {
+		return ""
+	}
+	members := strings.Split(value, ",")
+	if len(members) > 32 {
+		return ""
+	}
+	for _, m := range members {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if i := strings.IndexByte(m, '='); i <= 0 || i == len(m)-1 {
+			return ""
+		}
+	}
+	return value
+}
+
+// Span 记录一次请求在本服务内的处理过程
+type Span struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanID // 上游 Span 的ID，本服务是链路起点时为零值
+	Start      time.Time
+	End        time.Time
+	StatusCode int
+	Attributes map[string]string
+}
+
+// SpanExporter 负责把结束的 Span 发往追踪后端，实现需要保证并发安全
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// InMemoryExporter 把 Span 保存在内存中，供测试断言使用
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans 返回已导出 Span 的副本
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans := make([]*Span, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+var _ SpanExporter = (*InMemoryExporter)(nil)
+
+// Tracing 中间件：解析上游的 traceparent/tracestate，为本次请求创建子 Span，
+// 链路起点则新建 trace-id。请求处理结束后，已采样的 Span 交给 exporter 导出(exporter 为 nil 时只做传播)
+func Tracing(exporter SpanExporter) HandlerFunc {
+	return func(c *Context) {
+		span := &Span{
+			Name:  c.Method + " " + c.Path,
+			Start: time.Now(),
+			Attributes: map[string]string{
+				"http.method": c.Method,
+				"http.target": c.Req.RequestURI,
+			},
+		}
+		if parent, err := ParseTraceparent(c.Req.Header.Get(HeaderTraceparent)); err == nil {
+			span.Context.TraceID = parent.TraceID
+			span.Context.Flags = parent.Flags
+			span.Context.TraceState = parseTracestate(c.Req.Header.Get(HeaderTracestate))
+			span.Parent = parent.SpanID
+		} else {
+			span.Context.TraceID = newTraceID()
+			span.Context.Flags = 0x01 // 链路起点默认采样
+		}
+		span.Context.SpanID = newSpanID()
+		c.Set(spanKey, span)
+
+		c.Next()
+
+		span.End = time.Now()
+		if c.Pattern != "" {
+			span.Name = c.Method + " " + c.Pattern //以路由规则命名，避免路径参数让 Span 名称无限增长
+			span.Attributes["http.route"] = c.Pattern
+		}
+		span.StatusCode = c.StatusCode
+		if id := c.RequestID(); id != "" {
+			span.Attributes["request.id"] = id
+		}
+		if exporter != nil && span.Context.IsSampled() {
+			exporter.ExportSpan(span)
+		}
+	}
+}
+
+// Span 返回当前请求的 Span，未启用 Tracing 中间件时返回 nil
+func (c *Context) Span() *Span {
+	if v, ok := c.Get(spanKey); ok {
+		span, _ := v.(*Span)
+		return span
+	}
+	return nil
+}
+
+// TraceID 返回当前请求所属链路的 trace-id，未启用 Tracing 中间件时返回空字符串
+func (c *Context) TraceID() string {
+	if span := c.Span(); span != nil {
+		return span.Context.TraceID.String()
+	}
+	return ""
+}
+
+// InjectTrace 把当前 Span 作为父节点写入下游请求头，Handler 调用其他服务时使用：
+// req, _ := http.NewRequest("GET", url, nil); c.InjectTrace(req.Header)
+func (c *Context) InjectTrace(header http.Header) {
+	span := c.Span()
+	if span == nil {
+		return
+	}
+	header.Set(HeaderTraceparent, span.Context.Traceparent())
+	if span.Context.TraceState != "" {
+		header.Set(HeaderTracestate, span.Context.TraceState)
+	}
+	if id := c.RequestID(); id != "" {
+		header.Set(HeaderXRequestID, id)
+	}
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		randomBytes(id[:])
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		randomBytes(id[:])
+	}
+	return
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic("gee: reading random bytes: " + err.Error())
+	}
+}
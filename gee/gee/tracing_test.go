@@ -0,0 +1,84 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.IsSampled() {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("round trip failed: %s", sc.Traceparent())
+	}
+
+	invalid := []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",    // 非法版本
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",    // 全 0 trace-id
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",    // 全 0 parent-id
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",    // 大写
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xx", // 00 版本不允许扩展字段
+	}
+	for _, v := range invalid {
+		if _, err := ParseTraceparent(v); err == nil {
+			t.Errorf("expected %q to be rejected", v)
+		}
+	}
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"); err != nil {
+		t.Errorf("future version should be accepted: %v", err)
+	}
+}
+
+func TestRequestIDAndTracing(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	r := New()
+	r.Use(RequestID(), Tracing(exporter))
+	var outgoing http.Header
+	r.GET("/hello", func(c *Context) {
+		outgoing = make(http.Header)
+		c.InjectTrace(outgoing)
+		c.String(http.StatusOK, "hello")
+	})
+
+	req := httptest.NewRequest("GET", "/hello", nil)
+	req.Header.Set(HeaderXRequestID, "abc-123")
+	req.Header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(HeaderTracestate, "congo=t61rcWkgMzE")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get(HeaderXRequestID); got != "abc-123" {
+		t.Fatalf("request id should be propagated, got %q", got)
+	}
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent.String() != "00f067aa0ba902b7" {
+		t.Fatalf("span should continue the incoming trace: %+v", span)
+	}
+	if span.StatusCode != http.StatusOK || span.Attributes["request.id"] != "abc-123" {
+		t.Fatalf("unexpected span %+v", span)
+	}
+	sc, err := ParseTraceparent(outgoing.Get(HeaderTraceparent))
+	if err != nil || sc.SpanID != span.Context.SpanID || outgoing.Get(HeaderTracestate) != "congo=t61rcWkgMzE" {
+		t.Fatalf("outgoing headers should carry the current span: %v", outgoing)
+	}
+
+	// 请求头中的请求ID不合法时重新生成
+	req = httptest.NewRequest("GET", "/hello", nil)
+	req.Header.Set(HeaderXRequestID, "bad\nid")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get(HeaderXRequestID); got == "" || got == "bad\nid" {
+		t.Fatalf("invalid request id should be replaced, got %q", got)
+	}
+}
@@ -2,14 +2,20 @@ package gee
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 type node struct {
-	pattern  string  // 完整路由，例如 /p/:lang
-	part     string  // 路由中的一部分(当前节点)，例如 :lang
-	children []*node // 子节点，例如 [doc, tutorial, intro]
-	isWild   bool    // 是否模糊匹配，part 含有 : 或 * 时为true，默认为False
+	pattern  string            // 完整路由，例如 /p/:lang
+	part     string            // 路由中的一部分(当前节点)，例如 :lang
+	children []*node           // 子节点，例如 [doc, tutorial, intro]
+	isWild   bool              // 是否模糊匹配，part 含有 : 或 * 时为true，默认为False
+	match    func(string) bool // 参数约束，例如 :id<int> 只匹配整数；为 nil 时不做限制
+	alias    bool              // 可选参数省略时的前缀节点，pattern 指向完整路由，路由列表中不重复列出
 }
 
 func (n *node) String() string {
@@ -21,10 +27,15 @@ func (n *node) String() string {
 //因此，当匹配结束时，我们可以使用n.pattern == ""来判断路由规则是否匹配成功。
 //例如，/p/python虽能成功匹配到:lang，但:lang的pattern值为空，因此匹配失败
 //传入/p/*name/*,{"p", "*name"},0
-func (n *node) insert(pattern string, parts []string, height int) {
+//alias 表示这是可选参数省略时的前缀节点，与已有的其他路由落在同一个节点上时 panic
+func (n *node) insert(pattern string, parts []string, height int, alias bool) {
 	if len(parts) == height {
+		if n.pattern != "" && n.pattern != pattern && (alias || n.alias) {
+			panic("gee: route " + pattern + " conflicts with existing route " + n.pattern)
+		}
 		// 如果已经匹配完了，那么将pattern赋值给该node，表示它是一个完整的url
 		n.pattern = pattern
+		n.alias = alias
 		return
 	}
 
@@ -32,9 +43,16 @@ func (n *node) insert(pattern string, parts []string, height int) {
 	child := n.matchChild(part) //查看当前路由节点是否在已有的路由节点子列表里
 	if child == nil {
 		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
+		if part[0] == ':' {
+			_, child.match, _ = parseParam(part)
+		}
 		n.children = append(n.children, child)
+		//按优先级排序：静态节点 > 带约束的参数 > 普通参数 > 通配符，查询时优先尝试更精确的节点
+		sort.SliceStable(n.children, func(i, j int) bool {
+			return n.children[i].priority() < n.children[j].priority()
+		})
 	}
-	child.insert(pattern, parts, height+1)
+	child.insert(pattern, parts, height+1, alias)
 }
 
 //查询功能，同样也是递归查询每一层的节点，退出规则是，匹配到了*，匹配失败，或者匹配到了第len(parts)层节点。
@@ -62,9 +80,9 @@ func (n *node) search(parts []string, height int) *node {
 	return nil
 }
 
-// 查找所有已经注册的完整路由，保存到列表中
+// 查找所有已经注册的完整路由，保存到列表中，可选参数的前缀节点不重复列出
 func (n *node) travel(list *([]*node)) {
-	if n.pattern != "" {
+	if n.pattern != "" && !n.alias {
 		*list = append(*list, n)
 	}
 	for _, child := range n.children {
@@ -73,9 +91,10 @@ func (n *node) travel(list *([]*node)) {
 }
 
 // 找到匹配的子节点，场景是用在插入时使用，找到1个匹配的就立即返回(查询节点在已有节点子列表中是否存在，存在则匹配成功)
+// 插入时要求 part 完全相同，这样 /users/:id<int> 与 /users/:name 是两个不同的节点，整数以外的值可以落到后者
 func (n *node) matchChild(part string) *node {
 	for _, child := range n.children {
-		if child.part == part || child.isWild {
+		if child.part == part {
 			return child
 		}
 	}
@@ -83,13 +102,107 @@ func (n *node) matchChild(part string) *node {
 }
 
 // 所有匹配成功的节点，用于查找
-// 它必须返回所有可能的子节点来进行遍历查找
+// 它必须返回所有可能的子节点来进行遍历查找，不满足参数约束的节点被跳过
 func (n *node) matchChildren(part string) []*node {
 	nodes := make([]*node, 0)
 	for _, child := range n.children {
-		if child.part == part || child.isWild {
+		if child.part == part || (child.isWild && part != slashMarker && (child.match == nil || child.match(part))) {
 			nodes = append(nodes, child)
 		}
 	}
 	return nodes
 }
+
+// 忽略大小写的查询，用于 RedirectFixedPath。返回匹配路径上各段修正后的值：
+// 静态段使用路由规则中的写法，参数段和通配符保留请求中的原值
+func (n *node) searchFold(parts []string, height int) ([]string, bool) {
+	if len(parts) == height {
+		return nil, n.pattern != ""
+	}
+	part := parts[height]
+	for _, child := range n.children {
+		switch {
+		case !child.isWild:
+			if !strings.EqualFold(child.part, part) {
+				continue
+			}
+			part = child.part
+		case part == slashMarker:
+			continue
+		case child.part[0] == '*':
+			if child.pattern == "" {
+				continue
+			}
+			return parts[height:], true
+		case child.match != nil && !child.match(part):
+			continue
+		}
+		if rest, ok := child.searchFold(parts, height+1); ok {
+			return append([]string{part}, rest...), true
+		}
+		part = parts[height]
+	}
+	return nil, false
+}
+
+func (n *node) priority() int {
+	switch {
+	case !n.isWild:
+		return 0
+	case n.part[0] == ':' && n.match != nil:
+		return 1
+	case n.part[0] == ':':
+		return 2
+	default:
+		return 3
+	}
+}
+
+// 内置的参数约束，其余写在尖括号中的内容按正则表达式处理，例如 :name<[a-z]+\.txt>
+var paramConstraints = map[string]func(string) bool{
+	"int": func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	},
+	"uint": func(s string) bool {
+		_, err := strconv.ParseUint(s, 10, 64)
+		return err == nil
+	},
+	"uuid":  regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+	"alpha": regexp.MustCompile(`^[a-zA-Z]+$`).MatchString,
+}
+
+// 已编译的正则约束，避免每次生成 URL 时重复编译
+var constraintCache sync.Map
+
+// 解析参数段 :name、:name<约束>、:name?、:name<约束>?，返回参数名、约束和是否可选。
+// 正则约束按整段匹配(自动加上 ^ 和 $)，由于路由按 / 切分，正则中不能包含 /
+func parseParam(part string) (name string, match func(string) bool, optional bool) {
+	name, expr, optional := splitParam(part)
+	if expr == "" {
+		return name, nil, optional
+	}
+	if fn, ok := paramConstraints[expr]; ok {
+		return name, fn, optional
+	}
+	if fn, ok := constraintCache.Load(expr); ok {
+		return name, fn.(func(string) bool), optional
+	}
+	match = regexp.MustCompile("^(?:" + expr + ")$").MatchString
+	constraintCache.Store(expr, match)
+	return name, match, optional
+}
+
+// 只做字符串切分，不编译约束，用于请求处理中提取参数名
+func splitParam(part string) (name, constraint string, optional bool) {
+	name = part[1:]
+	if strings.HasSuffix(name, "?") {
+		optional = true
+		name = name[:len(name)-1]
+	}
+	if i := strings.IndexByte(name, '<'); i >= 0 && strings.HasSuffix(name, ">") {
+		constraint = name[i+1 : len(name)-1]
+		name = name[:i]
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package gee
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Route 是注册路由后返回的句柄
+type Route struct {
+	Method  string
+	Pattern string
+	engine  *Engine
+	router  *router
+}
+
+// Name 为路由命名，之后可以通过 Engine.URL 或模板函数 url 反向生成路径，
+// 例如 v1.POST("/login", handler).Name("login")。同一个名称只能注册一次
+func (r *Route) Name(name string) *Route {
+	if _, ok := r.engine.namedRoutes[name]; ok {
+		panic("gee: route name " + name + " is already registered")
+	}
+	r.engine.namedRoutes[name] = r
+	r.router.names[r.Method+"-"+r.Pattern] = name
+	return r
+}
+
+// URL 根据路由名称生成路径，params 为成对的参数名和参数值，例如
+// URL("user", "id", 42) 对于 /users/:id 生成 /users/42。
+// :param 的值按路径段转义，*catchall 的值保留其中的 /；不属于路由参数的键值对追加为查询字符串。
+// 路由按解码后的路径匹配，:param 的值中含有 / 时生成的路径无法匹配回该路由，因此返回错误
+func (engine *Engine) URL(name string, params ...interface{}) (string, error) {
+	route, ok := engine.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("gee: no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("gee: url %q: params must be key/value pairs", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("gee: url %q: param name %v is not a string", name, params[i])
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+
+	segments := strings.Split(route.Pattern, "/")
+	used := make(map[string]bool, len(values))
+	for i, seg := range segments {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		key, match, optional := seg[1:], func(string) bool { return true }, false
+		if seg[0] == ':' {
+			var m func(string) bool
+			if key, m, optional = parseParam(seg); m != nil {
+				match = m
+			}
+		}
+		value, ok := values[key]
+		if !ok {
+			if seg[0] == '*' || optional {
+				segments[i] = "" //未提供的 catch-all 和可选参数视为空
+				continue
+			}
+			return "", fmt.Errorf("gee: url %q: missing param %q", name, key)
+		}
+		used[key] = true
+		if seg[0] == '*' {
+			parts := strings.Split(strings.TrimPrefix(value, "/"), "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i] = strings.Join(parts, "/")
+		} else {
+			if value == "" || strings.Contains(value, "/") || !match(value) {
+				return "", fmt.Errorf("gee: url %q: invalid value %q for param %q", name, value, key)
+			}
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	path := strings.Join(segments, "/")
+	if trimmed := strings.TrimRight(path, "/"); trimmed != path && strings.HasSuffix(route.Pattern, "?") {
+		path = trimmed //去掉省略可选参数后留下的 /
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	query := url.Values{}
+	for key, value := range values {
+		if !used[key] {
+			query.Set(key, value)
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, nil
+}
@@ -0,0 +1,81 @@
+package gee
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Any 注册的请求方法
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+// Handle 以任意请求方法注册路由
+func (group *RouterGroup) Handle(method string, pattern string, handler HandlerFunc) *Route {
+	return group.addRoute(method, pattern, handler)
+}
+
+// Any 为同一个路由注册所有常用的请求方法
+func (group *RouterGroup) Any(pattern string, handler HandlerFunc) {
+	for _, method := range anyMethods {
+		group.addRoute(method, pattern, handler)
+	}
+}
+
+// WrapF 把标准库的 http.HandlerFunc 转换为 gee 的 HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		f(c.Writer, c.Req)
+	}
+}
+
+// WrapH 把 http.Handler 转换为 gee 的 HandlerFunc，例如
+// r.Any("/debug/pprof/*name", gee.WrapH(http.DefaultServeMux))
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// Mount 把 http.Handler(包括另一个 gee Engine)挂载到 prefix 下，转交请求前去掉路径中的前缀，
+// 例如 r.Mount("/admin", admin) 时，/admin/users 在 admin 中看到的路径是 /users。
+// 所有常用请求方法都会转交，组中的中间件照常执行
+func (group *RouterGroup) Mount(prefix string, h http.Handler) {
+	prefix = strings.TrimRight(prefix, "/")
+	absolutePath := group.prefix + prefix
+	handler := func(c *Context) {
+		req := new(http.Request)
+		*req = *c.Req
+		u := *c.Req.URL
+		u.Path = "/" + strings.TrimLeft(strings.TrimPrefix(u.Path, absolutePath), "/")
+		u.RawPath = "" //RawPath 与 Path 不一致时会被忽略，直接清空让标准库按 Path 重新编码
+		req.URL = &u
+		h.ServeHTTP(c.Writer, req)
+	}
+	group.Any(prefix, handler)
+	group.Any(prefix+"/*mountpath", handler)
+}
+
+// WrapMiddleware 让 func(http.Handler) http.Handler 形式的标准库中间件运行在 gee 的中间件链中。
+// 中间件调用 next 时继续执行后续的 Handler，并使用它传入的 ResponseWriter 和 Request(例如携带了新的 context)；
+// 没有调用 next 时视为拦截了请求，后续 Handler 不再执行
+func WrapMiddleware(middleware func(http.Handler) http.Handler) HandlerFunc {
+	return func(c *Context) {
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			writer, req := c.Writer, c.Req
+			if w != c.Writer {
+				c.Writer = &responseWriter{ResponseWriter: w, ctx: c}
+			}
+			c.Req = r
+			c.Next()
+			c.Writer, c.Req = writer, req
+		})
+		middleware(next).ServeHTTP(c.Writer, c.Req)
+		if !called {
+			c.Abort()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package gee
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	admin := New()
+	admin.GET("/users/:id", func(c *Context) {
+		c.String(http.StatusOK, "admin user %s", c.Param("id"))
+	})
+
+	r := New()
+	var trace []string
+	v1 := r.Group("/v1")
+	v1.Use(func(c *Context) { trace = append(trace, c.Path) })
+	v1.Mount("/admin", admin)
+	r.GET("/std", WrapF(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(req.URL.Path))
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/admin/users/42", nil))
+	if w.Body.String() != "admin user 42" || len(trace) != 1 {
+		t.Fatalf("mounted engine should see the stripped path, got %q %v", w.Body.String(), trace)
+	}
+
+	var status int
+	r.Use(func(c *Context) {
+		c.Next()
+		status = c.StatusCode
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/std", nil))
+	if w.Code != http.StatusTeapot || w.Body.String() != "/std" || status != http.StatusTeapot {
+		t.Fatalf("unexpected response %d %q, status %d", w.Code, w.Body.String(), status)
+	}
+}
+
+type ctxKey struct{}
+
+func TestWrapMiddleware(t *testing.T) {
+	r := New()
+	r.Use(WrapMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), ctxKey{}, "gee")))
+		})
+	}))
+	called := false
+	r.GET("/", func(c *Context) {
+		called = true
+		c.String(http.StatusOK, "%v", c.Req.Context().Value(ctxKey{}))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusUnauthorized || called {
+		t.Fatalf("middleware should stop the chain, got %d, handler called %v", w.Code, called)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "gee" {
+		t.Fatalf("handler should see the request from the middleware, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// 重复写出的状态码被丢弃，StatusCode 与客户端收到的一致
+func TestStatusDuplicateWriteHeader(t *testing.T) {
+	r := New()
+	var status int
+	r.Use(func(c *Context) {
+		c.Next()
+		status = c.StatusCode
+	})
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusCreated, "created")
+		c.String(http.StatusInternalServerError, "again")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusCreated || status != http.StatusCreated {
+		t.Fatalf("expect 201, got response %d, StatusCode %d", w.Code, status)
+	}
+}
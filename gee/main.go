@@ -1,8 +1,11 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
+	_ "net/http/pprof" //在 http.DefaultServeMux 上注册 /debug/pprof/ 系列路由
+	"os"
 
 	"html/template"
 	"time"
@@ -16,7 +19,25 @@ func FormatAsDate(t time.Time) string {
 	return fmt.Sprintf("%d-%02d-%02d", year, month, day)
 }
 func main() {
+	var routes bool
+	flag.BoolVar(&routes, "routes", false, "Print the route table as JSON and exit")
+	flag.Parse()
+
 	r := gee.Default()
+	//只采信本机反向代理(例如 nginx)传递的 X-Forwarded-For 等请求头，Logger 打印的是真实客户端IP
+	if err := r.SetTrustedProxies([]string{"127.0.0.1", "::1"}); err != nil {
+		panic(err)
+	}
+	r.Use(gee.RequestID()) //为每个请求生成或沿用 X-Request-ID，Logger 会一并打印
+	r.Use(gee.Metrics())
+	r.Use(gee.BodyLimit(1 << 20)) //请求体最多 1MB，超出时响应 413
+	r.Use(gee.ErrorHandler(nil)) //Handler 通过 c.Error 记录的错误统一转换为 JSON 响应
+	secure := gee.DefaultSecureConfig
+	secure.SSLRedirect = false //本地开发使用 HTTP，部署到 HTTPS 后去掉这一行
+	r.Use(gee.Secure(secure))
+	r.Use(gee.CSRF()) //不安全方法的请求需要携带 CSRF token，表单中通过 {{csrfField}} 生成
+	r.GET("/metrics", gee.MetricsHandler()) //Prometheus 抓取地址
+	r.Any("/debug/pprof/*name", gee.WrapH(http.DefaultServeMux)) //pprof 依赖完整路径，直接转交而不去掉前缀
 	r.SetFuncMap(template.FuncMap{   //自定义渲染函数
 		"FormatAsDate": FormatAsDate,
 	})
@@ -32,7 +53,7 @@ func main() {
 				"username": c.PostForm("username"),
 				"password": c.PostForm("password"),
 			})
-		})
+		}).Name("login") //命名路由，模板中通过 {{url "login"}} 生成路径
 
 	}
 
@@ -43,5 +64,14 @@ func main() {
 			"now":   time.Date(2000, 11, 1, 0, 0, 0, 0, time.UTC),
 		})
 	})
+	if routes { //导出路由表，供 API 网关生成配置：example -routes > routes.json
+		data, err := r.RoutesJSON()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
 	r.Run(":8000") //在这里构造了一个 Context 对象
 }
@@ -2,6 +2,7 @@ package geecache
 /**
 缓存值的抽象与封装
 */
+import "unsafe"
 
 //抽象了一个只读数据结构 ByteView 用来表示缓存值
 type ByteView struct {
@@ -14,6 +15,11 @@ func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+// Size 实现 lru.Sizer：ByteView 存入缓存时被装箱为接口，需要额外分配切片头，底层数组按容量计算
+func (v ByteView) Size() int64 {
+	return int64(unsafe.Sizeof(v)) + int64(cap(v.b))
+}
+
 // b 是只读的，ByteSlice()以字节片的形式返回数据的副本拷贝,防止缓存值被外部程序修改
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
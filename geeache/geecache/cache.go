@@ -1,40 +1,160 @@
 package geecache
 /**
-并发控制（实例化 lru，封装 get 和 add 方法，并添加互斥锁 mu）
+并发控制（实例化淘汰策略(默认 lru)，封装 get 和 add 方法，并添加互斥锁 mu）
 */
 import (
 	"geecache/lru"
+	"geecache/policy"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// cacher 是 Group 对本地缓存的操作，cache 与 shardedCache 都实现了该接口
+type cacher interface {
+	add(key string, value ByteView, expire time.Time)
+	get(key string) (value ByteView, ok bool)
+	remove(key string)
+	purge()
+	removeExpired() int
+	removeOldest()
+	bytes() int64
+	stats() CacheStats
+}
+
 type cache struct {
+	used       int64 //已使用的内存，持有 mu 时原子地更新，bytes() 不需要加锁
+	total      *int64 //属于 shardedCache 时指向各段的合计，随 used 一起更新
 	mu         sync.Mutex //cache 的 get 和 add 都涉及到写操作(LRU 将最近访问元素移动到链表头)，所以不能直接改为读写锁
-	lru        *lru.Cache
+	store      policy.Cache //按淘汰策略管理的缓存，默认是 lru.Cache
+	newStore   policy.Factory //创建 store 使用的淘汰策略，为 nil 时使用 policy.LRU
 	cacheBytes int64 //允许使用的最大内存
+	maxEntries int //允许保存的最大记录数，0 表示不限制，store 需要实现 policy.EntryLimiter
+	now        func() time.Time //判断过期使用的时钟，为 nil 时使用 time.Now
+
+	//统计信息，都在持有 mu 时修改
+	nget, nhit, nevict int64
+	removing           bool //正在主动删除(Remove)，store 的回调不计入淘汰次数
 }
 
-//判断了 c.lru 是否为 nil，如果等于 nil 再创建实例。
+//判断了 c.store 是否为 nil，如果等于 nil 再创建实例。
 //这种方法称之为延迟初始化(Lazy Initialization)，
 //一个对象的延迟初始化意味着该对象的创建将会延迟至第一次使用该对象时。主要用于提高性能，并减少程序内存要求
-func (c *cache) add(key string, value ByteView) {
+func (c *cache) add(key string, value ByteView, expire time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	if c.store == nil {
+		newStore := c.newStore
+		if newStore == nil {
+			newStore = policy.LRU
+		}
+		c.store = newStore(c.cacheBytes, c.onEvicted, c.now)
+		if l, ok := c.store.(policy.EntryLimiter); ok && c.maxEntries > 0 {
+			l.SetMaxEntries(c.maxEntries)
+		}
 	}
-	c.lru.Add(key, value)
+	if c.cacheBytes != 0 && lru.EntrySize(key, value) > c.cacheBytes {
+		//放不下的值会被 store 拒绝，同时移除同一个 key 的旧值，这不是淘汰
+		c.removing = true
+		defer func() { c.removing = false }()
+	}
+	c.store.AddWithExpire(key, value, expire)
+	c.updateBytes()
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	c.nget++
+	if c.store == nil {
 		return
 	}
 
-	if v, ok := c.lru.Get(key); ok {
+	v, ok := c.store.Get(key)
+	c.updateBytes() //Get 可能惰性删除过期的记录
+	if ok {
+		c.nhit++
 		return v.(ByteView), ok //转换为ByteView类型
 	}
 
 	return
 }
+
+// 移除所有已过期的缓存，返回移除的个数
+func (c *cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return 0
+	}
+	defer c.updateBytes()
+	return c.store.RemoveExpired()
+}
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store != nil {
+		c.removing = true
+		c.store.Remove(key)
+		c.removing = false
+		c.updateBytes()
+	}
+}
+
+// 清空缓存，下次 add 时重新创建 store
+func (c *cache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = nil
+	c.updateBytes()
+}
+
+// 当前已使用的内存，不需要加锁
+func (c *cache) bytes() int64 {
+	return atomic.LoadInt64(&c.used)
+}
+
+// 修改 store 之后同步 used 和 total，调用时已经持有 mu
+func (c *cache) updateBytes() {
+	var b int64
+	if c.store != nil {
+		b = c.store.Bytes()
+	}
+	if delta := b - c.used; delta != 0 {
+		atomic.StoreInt64(&c.used, b)
+		if c.total != nil {
+			atomic.AddInt64(c.total, delta)
+		}
+	}
+}
+
+// 按淘汰策略淘汰一条缓存
+func (c *cache) removeOldest() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store != nil {
+		c.store.RemoveOldest()
+		c.updateBytes()
+	}
+}
+
+// store 因为容量或过期移除节点时计数，调用时已经持有 mu
+func (c *cache) onEvicted(key string, value policy.Value) {
+	if !c.removing {
+		c.nevict++
+	}
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{Gets: c.nget, Hits: c.nhit, Evictions: c.nevict}
+	if c.store != nil {
+		s.Bytes = c.store.Bytes()
+		s.Items = int64(c.store.Len())
+	}
+	return s
+}
+
+var _ cacher = (*cache)(nil)
@@ -1,7 +1,6 @@
 package consistenthash
 
 import (
-	"fmt"
 	"hash/crc32"
 	"sort"
 	"strconv"
@@ -16,6 +15,7 @@ type Map struct {
 	replicas int //虚拟节点倍数
 	keys     []int // 哈希环
 	hashMap  map[int]string //虚拟节点与真实节点的映射表，键是虚拟节点的哈希值，值是真实节点的名称
+	others   map[int][]string //哈希冲突时没有得到该位置的其他节点，当前的节点删除后由其中名称最小的接替
 }
 
 //  允许自定义虚拟节点倍数和 Hash 函数
@@ -24,6 +24,7 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		others:   make(map[int][]string),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -34,20 +35,29 @@ func New(replicas int, fn Hash) *Map {
 // 生成虚拟节点经过哈希处理后添加至环上并排序
 // 添加真实节点/机器（允许传入 0 或 多个真实节点的名称）
 func (m *Map) Add(keys ...string) {
-	count:=0
 	for _, key := range keys {
 		//对每一个真实节点 key，对应创建 m.replicas 个虚拟节点
 		for i := 0; i < m.replicas; i++ {
 			//虚拟节点的名称是：(将数字i转为字符串)strconv.Itoa(i) + key，即通过添加编号的方式区分不同虚拟节点
 			//使用 m.hash() 计算虚拟节点的哈希值，使用 append(m.keys, hash) 添加到环上
 			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+			if owner, ok := m.hashMap[hash]; ok {
+				//与其他节点的虚拟节点哈希冲突时名称较小的节点得到该位置，与添加的顺序无关，
+				//各个节点按不同的顺序添加也能得到相同的环；重复添加同一个节点时什么也不做
+				if owner != key && !contains(m.others[hash], key) {
+					loser := key
+					if key < owner {
+						m.hashMap[hash], loser = key, owner
+					}
+					m.others[hash] = append(m.others[hash], loser)
+				}
+				continue
+			}
 			m.keys = append(m.keys, hash) //将虚拟节点的哈希值添加到环上
 			m.hashMap[hash] = key //在 hashMap 中增加虚拟节点和真实节点的映射关系
-			count+=1
 		}
 	}
 	sort.Ints(m.keys) //环上的虚拟节点(哈希值)升序排列
-	fmt.Printf("虚拟节点个数:%v\n",count)
 }
 
 //使用key经过哈希处理，最终返回key应该存放在哪个真实节点上(在哈希环上顺时针查找)
@@ -72,11 +82,157 @@ func (m *Map) Get(key string) string {
 }
 
 // 删除环和映射上的节点及虚拟节点（自添加）
+// 只删除确实属于该节点的虚拟节点：节点不存在时跳过；虚拟节点因哈希冲突属于其他节点时只删除冲突记录，
+// 该位置还有其他节点冲突时交给其中名称最小的节点，而不是从环上删除
 func (m *Map) Remove(key string) {
 	for i := 0; i < m.replicas; i++ {
 		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		owner, ok := m.hashMap[hash]
+		if !ok {
+			continue
+		}
+		others := m.others[hash]
+		if owner != key {
+			m.setOthers(hash, remove(others, key))
+			continue
+		}
+		if len(others) > 0 {
+			next := others[0]
+			for _, o := range others[1:] {
+				if o < next {
+					next = o
+				}
+			}
+			m.hashMap[hash] = next
+			m.setOthers(hash, remove(others, next))
+			continue
+		}
 		idx := sort.SearchInts(m.keys, hash)
 		m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
 		delete(m.hashMap, hash)
 	}
+}
+
+func (m *Map) setOthers(hash int, others []string) {
+	if len(others) == 0 {
+		delete(m.others, hash)
+	} else {
+		m.others[hash] = others
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回删除 s 之后的新切片，不修改 list
+func remove(list []string, s string) []string {
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Clone 返回一份独立的拷贝，修改拷贝不影响原来的 Map，用于写时复制
+func (m *Map) Clone() *Map {
+	c := &Map{
+		hash:     m.hash,
+		replicas: m.replicas,
+		keys:     make([]int, len(m.keys)),
+		hashMap:  make(map[int]string, len(m.hashMap)),
+		others:   make(map[int][]string, len(m.others)),
+	}
+	copy(c.keys, m.keys)
+	for k, v := range m.hashMap {
+		c.hashMap[k] = v
+	}
+	for k, v := range m.others {
+		c.others[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// Hash 返回 key 在环上的位置，可以用 Range.Contains 判断 key 是否在迁移的区间中
+func (m *Map) Hash(key string) uint32 {
+	return m.hash([]byte(key))
+}
+
+// Range 是哈希环上的一段区间 (Start, End]，其中的 key 从节点 From 迁移到了节点 To。
+// Start >= End 时区间跨过了 0，即 (Start, MaxUint32] 加上 [0, End]；节点为空表示环上没有节点
+type Range struct {
+	Start, End uint32
+	From, To   string
+}
+
+// Contains 判断哈希值 h 是否在区间内
+func (r Range) Contains(h uint32) bool {
+	if r.Start < r.End {
+		return h > r.Start && h <= r.End
+	}
+	return h > r.Start || h <= r.End
+}
+
+// Moved 比较 old 与 m，返回归属发生变化的区间，相邻且迁移方向相同的区间会合并。
+// 两个环上所有的虚拟节点把环分成若干段，同一段中的 key 在两个环上分别属于同一个节点
+func (m *Map) Moved(old *Map) []Range {
+	points := mergePoints(old.keys, m.keys)
+	if len(points) == 0 {
+		return nil
+	}
+	var moved []Range
+	for i, end := range points {
+		start := points[(i+len(points)-1)%len(points)] //第一段从最后一个点跨过 0
+		from, to := old.owner(end), m.owner(end)
+		if from == to {
+			continue
+		}
+		if n := len(moved); n > 0 && moved[n-1].End == uint32(start) && moved[n-1].From == from && moved[n-1].To == to {
+			moved[n-1].End = uint32(end)
+			continue
+		}
+		moved = append(moved, Range{Start: uint32(start), End: uint32(end), From: from, To: to})
+	}
+	//首尾两段在 0 处相接时合并
+	if n := len(moved); n > 1 && moved[n-1].End == moved[0].Start && moved[n-1].From == moved[0].From && moved[n-1].To == moved[0].To {
+		moved[0].Start = moved[n-1].Start
+		moved = moved[:n-1]
+	}
+	return moved
+}
+
+// 哈希值 hash 所属的真实节点，与 Get 的查找方式相同
+func (m *Map) owner(hash int) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+	idx := sort.SearchInts(m.keys, hash)
+	return m.hashMap[m.keys[idx%len(m.keys)]]
+}
+
+// 合并两个升序的切片并去重
+func mergePoints(a, b []int) []int {
+	points := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var v int
+		if j == len(b) || (i < len(a) && a[i] < b[j]) {
+			v = a[i]
+			i++
+		} else {
+			v = b[j]
+			j++
+		}
+		if n := len(points); n == 0 || points[n-1] != v {
+			points = append(points, v)
+		}
+	}
+	return points
 }
\ No newline at end of file
@@ -2,6 +2,7 @@ package consistenthash
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -46,3 +47,98 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func newTestMap() *Map {
+	return New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+}
+
+func TestRemove(t *testing.T) {
+	hash := newTestMap()
+	hash.Add("6", "4", "2")
+	hash.Remove("9") //不存在的节点不能误删其他节点的虚拟节点
+	if len(hash.keys) != 9 || hash.Get("27") != "2" {
+		t.Fatalf("删除不存在的节点后环被破坏: %v", hash.keys)
+	}
+	hash.Add("2") //重复添加不会产生重复的虚拟节点
+	if len(hash.keys) != 9 {
+		t.Fatalf("重复添加后虚拟节点个数为 %d", len(hash.keys))
+	}
+	hash.Remove("2")
+	if len(hash.keys) != 6 || hash.Get("27") != "4" || hash.Get("11") != "4" {
+		t.Fatalf("删除 2 之后 27、11 应该属于 4: %v", hash.keys)
+	}
+}
+
+func TestMoved(t *testing.T) {
+	old := newTestMap()
+	old.Add("6", "4", "2")
+	m := old.Clone()
+	m.Add("8")
+	if len(old.keys) != 9 {
+		t.Fatalf("修改 Clone 的结果不应影响原来的 Map")
+	}
+
+	want := []Range{{6, 8, "2", "8"}, {16, 18, "2", "8"}, {26, 28, "2", "8"}}
+	if moved := m.Moved(old); !reflect.DeepEqual(moved, want) {
+		t.Fatalf("moved = %v, want %v", moved, want)
+	}
+	if !want[2].Contains(m.Hash("27")) || want[2].Contains(m.Hash("26")) {
+		t.Fatalf("Contains 应该是左开右闭区间")
+	}
+
+	//删除的方向相反
+	back := m.Clone()
+	back.Remove("8")
+	if moved := back.Moved(m); len(moved) != 3 || moved[0].From != "8" || moved[0].To != "2" {
+		t.Fatalf("moved = %v", moved)
+	}
+
+	//从空环开始，整个环都迁移到新节点
+	empty := newTestMap()
+	one := empty.Clone()
+	one.Add("2")
+	moved := one.Moved(empty)
+	if len(moved) != 1 || moved[0].From != "" || moved[0].To != "2" || !moved[0].Contains(100) {
+		t.Fatalf("moved = %v", moved)
+	}
+}
+
+//节点 2 的虚拟节点 12 与节点 12 的虚拟节点 012 哈希冲突，无论添加的顺序如何都由名称较小的 12 得到该位置
+func TestCollision(t *testing.T) {
+	a, b := newTestMap(), newTestMap()
+	a.Add("2", "12")
+	b.Add("12", "2")
+	for i := 0; i < 300; i++ {
+		key := strconv.Itoa(i)
+		if a.Get(key) != b.Get(key) {
+			t.Fatalf("添加顺序不同，%s 分别属于 %s 和 %s", key, a.Get(key), b.Get(key))
+		}
+	}
+	if a.Get("11") != "12" || len(a.keys) != 5 {
+		t.Fatalf("冲突的位置应该属于 12，got %s, %v", a.Get("11"), a.keys)
+	}
+
+	//删除得到该位置的节点后交给冲突的另一个节点
+	c := a.Clone()
+	c.Remove("12")
+	if c.Get("11") != "2" || len(c.keys) != 3 || a.Get("11") != "12" {
+		t.Fatalf("删除 12 之后 11 应该属于 2，got %s, %v", c.Get("11"), c.keys)
+	}
+	c.Add("12")
+	if c.Get("11") != "12" {
+		t.Fatalf("重新添加 12 之后 11 应该属于 12，got %s", c.Get("11"))
+	}
+
+	//删除没有得到该位置的节点不影响该位置
+	b.Remove("2")
+	if b.Get("11") != "12" || len(b.keys) != 3 {
+		t.Fatalf("删除 2 之后 11 应该仍属于 12，got %s, %v", b.Get("11"), b.keys)
+	}
+	b.Remove("12")
+	if len(b.keys) != 0 || len(b.others) != 0 {
+		t.Fatalf("删除所有节点后环应该为空: %v %v", b.keys, b.others)
+	}
+}
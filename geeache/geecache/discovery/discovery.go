@@ -0,0 +1,88 @@
+package discovery
+
+/**
+节点发现：为 HTTPPool 提供集群中的节点列表，节点变化时通知 HTTPPool 更新一致性哈希环
+Static  固定的节点列表
+File    定期读取配置文件，每行一个节点地址
+DNS     定期查询 A/AAAA 或 SRV 记录
+Gossip  SWIM 风格的 gossip 协议，节点之间互相探测，自动发现新节点并剔除故障节点
+*/
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Discovery 发现集群中的节点
+type Discovery interface {
+	// Watch 在节点列表变化时调用 update，传入完整的节点地址列表(包括自己，已排序)，
+	// 第一次获取到列表时也会调用。Watch 一直阻塞，直到 ctx 取消时返回 ctx.Err()
+	Watch(ctx context.Context, update func(peers []string)) error
+}
+
+// Static 是固定的节点列表
+type Static []string
+
+func (s Static) Watch(ctx context.Context, update func(peers []string)) error {
+	update(normalize(s))
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// 每隔 interval 调用一次 fetch，列表变化时调用 update；fetch 失败时保留上一次的列表，错误交给 onError
+func poll(ctx context.Context, interval time.Duration, fetch func(ctx context.Context) ([]string, error),
+	update func(peers []string), onError func(err error)) error {
+	var last []string
+	first := true
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		peers, err := fetch(ctx)
+		if err != nil {
+			if onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		} else if peers = normalize(peers); first || !equal(peers, last) {
+			update(peers)
+			last, first = peers, false
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// 返回排序并去重后的拷贝
+func normalize(peers []string) []string {
+	sorted := make([]string, 0, len(peers))
+	seen := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			sorted = append(sorted, p)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	_ Discovery = Static(nil)
+	_ Discovery = (*File)(nil)
+	_ Discovery = (*DNS)(nil)
+	_ Discovery = (*Gossip)(nil)
+)
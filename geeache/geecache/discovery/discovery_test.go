@@ -0,0 +1,178 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录每次 update 的结果
+type recorder struct {
+	mu      sync.Mutex
+	updates [][]string
+}
+
+func (r *recorder) update(peers []string) {
+	r.mu.Lock()
+	r.updates = append(r.updates, peers)
+	r.mu.Unlock()
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.updates)
+}
+
+func (r *recorder) last() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.updates) == 0 {
+		return nil
+	}
+	return r.updates[len(r.updates)-1]
+}
+
+// 在 deadline 之前等待 cond 成立
+func eventually(t *testing.T, timeout time.Duration, cond func() bool, format string, args ...interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func watch(d Discovery) (*recorder, context.CancelFunc, chan error) {
+	r := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Watch(ctx, r.update) }()
+	return r, cancel, done
+}
+
+func TestStatic(t *testing.T) {
+	r, cancel, done := watch(Static{"http://b", "http://a", "http://b"})
+	eventually(t, time.Second, func() bool { return r.count() == 1 }, "Static 应该调用一次 update")
+	if !reflect.DeepEqual(r.last(), []string{"http://a", "http://b"}) {
+		t.Fatalf("节点列表应该排序并去重，got %v", r.last())
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("ctx 取消后应该返回 context.Canceled，got %v", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "peers")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# geecache peers\nhttp://localhost:8001\n\n  http://localhost:8002  \n")
+
+	var errs int32
+	var errMu sync.Mutex
+	f := &File{Path: path, Interval: 10 * time.Millisecond, OnError: func(error) {
+		errMu.Lock()
+		errs++
+		errMu.Unlock()
+	}}
+	r, cancel, _ := watch(f)
+	defer cancel()
+	eventually(t, time.Second, func() bool {
+		return reflect.DeepEqual(r.last(), []string{"http://localhost:8001", "http://localhost:8002"})
+	}, "应该读取到文件中的节点，got %v", r.last())
+
+	write("http://localhost:8001\nhttp://localhost:8003\n")
+	eventually(t, time.Second, func() bool {
+		return reflect.DeepEqual(r.last(), []string{"http://localhost:8001", "http://localhost:8003"})
+	}, "文件变化后应该通知新的节点列表，got %v", r.last())
+
+	//文件暂时不可读时保留上一次的列表
+	n := r.count()
+	os.Remove(path)
+	eventually(t, time.Second, func() bool {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return errs > 0
+	}, "读取失败应该调用 OnError")
+	if r.count() != n {
+		t.Fatalf("读取失败时不应该通知更新")
+	}
+}
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	hosts []string
+	srvs  []*net.SRV
+	err   error
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hosts, r.err
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return name, r.srvs, r.err
+}
+
+func (r *fakeResolver) set(hosts []string, err error) {
+	r.mu.Lock()
+	r.hosts, r.err = hosts, err
+	r.mu.Unlock()
+}
+
+func TestDNS(t *testing.T) {
+	resolver := &fakeResolver{hosts: []string{"10.0.0.2", "10.0.0.1", "::1"}}
+	d := &DNS{Name: "geecache.local", Port: 8001, Interval: 10 * time.Millisecond, Resolver: resolver}
+	r, cancel, _ := watch(d)
+	defer cancel()
+	eventually(t, time.Second, func() bool {
+		return reflect.DeepEqual(r.last(), []string{"http://10.0.0.1:8001", "http://10.0.0.2:8001", "http://[::1]:8001"})
+	}, "A 记录，got %v", r.last())
+
+	resolver.set(nil, errors.New("timeout"))
+	time.Sleep(50 * time.Millisecond)
+	resolver.set([]string{"10.0.0.1"}, nil)
+	eventually(t, time.Second, func() bool {
+		return reflect.DeepEqual(r.last(), []string{"http://10.0.0.1:8001"})
+	}, "记录变化后应该通知，got %v", r.last())
+	if r.count() != 2 {
+		t.Fatalf("查询失败时不应该通知更新，got %v", r.updates)
+	}
+}
+
+func TestDNSSRV(t *testing.T) {
+	resolver := &fakeResolver{srvs: []*net.SRV{
+		{Target: "node1.geecache.local.", Port: 8001},
+		{Target: "node2.geecache.local.", Port: 8002},
+	}}
+	d := &DNS{Name: "_geecache._tcp.geecache.local", SRV: true, Scheme: "https", Resolver: resolver}
+	r, cancel, _ := watch(d)
+	defer cancel()
+	eventually(t, time.Second, func() bool { return r.count() == 1 }, "SRV 记录应该通知一次")
+	want := []string{"https://node1.geecache.local:8001", "https://node2.geecache.local:8002"}
+	if !reflect.DeepEqual(r.last(), want) {
+		t.Fatalf("got %v, want %v", r.last(), want)
+	}
+}
@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultDNSInterval = 30 * time.Second
+
+// Resolver 是 DNS 查询需要的方法，*net.Resolver 实现了该接口，测试时可以替换
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNS 定期查询 DNS 记录得到节点列表。
+// SRV 为 false 时查询 Name 的 A/AAAA 记录，节点地址为 Scheme://IP:Port；
+// SRV 为 true 时 Name 是完整的 SRV 记录名，例如 _geecache._tcp.example.com，使用记录中的主机和端口
+type DNS struct {
+	Name     string
+	SRV      bool
+	Port     int             // A/AAAA 记录使用的端口
+	Scheme   string          // 默认 http
+	Interval time.Duration   // 查询间隔，默认 30 秒
+	Resolver Resolver        // 默认 net.DefaultResolver
+	OnError  func(err error) // 查询失败时调用，可以为 nil；失败时保留上一次的列表
+}
+
+func (d *DNS) Watch(ctx context.Context, update func(peers []string)) error {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = defaultDNSInterval
+	}
+	return poll(ctx, interval, d.lookup, update, d.OnError)
+}
+
+func (d *DNS) lookup(ctx context.Context) ([]string, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	scheme := d.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	var peers []string
+	if d.SRV {
+		_, records, err := resolver.LookupSRV(ctx, "", "", d.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			peers = append(peers, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+		}
+		return peers, nil
+	}
+	addrs, err := resolver.LookupHost(ctx, d.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		peers = append(peers, scheme+"://"+net.JoinHostPort(addr, strconv.Itoa(d.Port)))
+	}
+	return peers, nil
+}
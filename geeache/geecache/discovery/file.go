@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultFileInterval = 5 * time.Second
+
+// File 定期读取配置文件中的节点列表，文件内容变化后通知更新。
+// 文件每行一个节点地址，例如 http://10.0.0.2:8001，空行和以 # 开头的行会被忽略
+type File struct {
+	Path     string
+	Interval time.Duration   // 检查文件的间隔，默认 5 秒
+	OnError  func(err error) // 读取文件失败时调用，可以为 nil；失败时保留上一次的列表
+}
+
+func NewFile(path string) *File {
+	return &File{Path: path}
+}
+
+func (f *File) Watch(ctx context.Context, update func(peers []string)) error {
+	interval := f.Interval
+	if interval <= 0 {
+		interval = defaultFileInterval
+	}
+	return poll(ctx, interval, f.read, update, f.OnError)
+}
+
+func (f *File) read(context.Context) ([]string, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var peers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		peers = append(peers, line)
+	}
+	return peers, scanner.Err()
+}
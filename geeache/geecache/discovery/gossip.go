@@ -0,0 +1,674 @@
+package discovery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+SWIM(Scalable Weakly-consistent Infection-style Process Group Membership)：
+每个探测周期随机选择一个节点发送 ping，超时没有收到 ack 时，请 k 个其他节点代为 ping(ping-req)，
+仍然没有 ack 则把该节点标记为怀疑(suspect)；怀疑超过 SuspicionTimeout 后判定为死亡(dead)。
+被怀疑的节点收到消息后增大自己的 incarnation 并广播 alive 来反驳，避免因为网络抖动误判。
+成员状态的变化不单独发送，而是捎带在 ping/ack 等消息中传播(infection-style)。
+新节点通过 sync 消息与种子节点交换完整的成员列表。
+设置 SecretKey 后每条消息都带有 HMAC 签名，没有密钥的节点不能伪造成员；死亡的成员保留 DeadTimeout 后删除
+*/
+
+const (
+	msgPing     = "ping"
+	msgPingReq  = "ping-req"
+	msgAck      = "ack"
+	msgSync     = "sync"      // 新节点加入时发送完整的成员列表
+	msgSyncResp = "sync-resp" // 回复 sync，同样携带完整的成员列表
+
+	maxPiggyback   = 16               // 每条消息最多捎带的状态变化
+	maxPacketSize  = 64 * 1024        // UDP 包的最大长度
+	maxJoinBackoff = 30 * time.Second // 重试加入集群的最大间隔
+)
+
+// MemberState 是成员的状态
+type MemberState int
+
+const (
+	StateAlive MemberState = iota
+	StateSuspect
+	StateDead
+)
+
+func (s MemberState) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	}
+	return "unknown"
+}
+
+// Member 是 gossip 集群中的一个成员
+type Member struct {
+	Name        string
+	Addr        string // gossip 使用的 UDP 地址
+	Meta        string // 节点对外的 HTTP 地址，即交给 HTTPPool 的节点地址
+	Incarnation uint64 // 只有成员自己会增大，用来区分新旧状态
+	State       MemberState
+}
+
+// GossipConfig 是 Gossip 的配置，零值字段使用默认值
+type GossipConfig struct {
+	Name     string // 节点的唯一名称，默认使用 AdvertiseAddr
+	BindAddr string // UDP 监听地址，例如 127.0.0.1:7946，端口为 0 时随机选择
+	// AdvertiseAddr 是其他节点访问自己使用的 UDP 地址，默认是实际监听的地址；
+	// 监听 0.0.0.0 等通配地址时必须设置
+	AdvertiseAddr string
+	Meta          string   // 节点对外的 HTTP 地址，例如 http://10.0.0.2:8001
+	Seeds         []string // 启动时联系的其他节点的 gossip 地址
+
+	ProbeInterval    time.Duration // 探测周期，默认 1 秒
+	ProbeTimeout     time.Duration // 等待 ack 的时间，默认 ProbeInterval 的 1/2
+	IndirectProbes   int           // 直接探测失败后委托探测的节点数，默认 3
+	SuspicionTimeout time.Duration // 怀疑多久后判定为死亡，默认 5 个探测周期
+	RetransmitMult   int           // 每条状态变化捎带发送 RetransmitMult*log2(成员数+1) 次，默认 4
+	DeadTimeout      time.Duration // 死亡的成员保留多久后从成员列表中删除，默认 30 个探测周期
+
+	// SecretKey 是集群共享的密钥，设置后每条消息都带有 HMAC-SHA256 签名，没有签名或签名错误的消息被丢弃。
+	// 集群中所有节点必须使用相同的密钥。签名只防止伪造，不加密消息，也不防止重放
+	SecretKey []byte
+}
+
+// 捎带在消息中的成员状态
+type update struct {
+	Name        string      `json:"name"`
+	Addr        string      `json:"addr"`
+	Meta        string      `json:"meta"`
+	Incarnation uint64      `json:"inc"`
+	State       MemberState `json:"state"`
+}
+
+type message struct {
+	Type    string   `json:"type"`
+	Seq     uint64   `json:"seq,omitempty"`
+	Target  string   `json:"target,omitempty"` // ping-req 要探测的节点地址
+	Updates []update `json:"updates,omitempty"`
+}
+
+type member struct {
+	Member
+	suspectAt time.Time
+	deadAt    time.Time
+}
+
+// 等待捎带发送的状态变化
+type broadcast struct {
+	update    update
+	transmits int
+}
+
+// Gossip 使用 SWIM 协议维护集群成员，实现了 Discovery：存活和被怀疑的成员的 Meta 组成节点列表
+type Gossip struct {
+	config GossipConfig
+	conn   net.PacketConn
+	self   string // 自己的名称
+
+	mu         sync.Mutex
+	members    map[string]*member
+	broadcasts []*broadcast
+	acks       map[uint64]chan struct{} // 等待 ack 的探测，键是 Seq
+	seq        uint64
+	probeOrder []string // 打乱顺序后依次探测，保证每个成员在有限时间内都会被探测到
+	watchers   []chan struct{}
+	joined     chan struct{} // 收到 sync-resp 或发现其他成员后关闭，Join 不再重试
+	joinOnce   sync.Once
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewGossip 监听 UDP 端口并开始探测，随后联系 Seeds 加入集群
+func NewGossip(config GossipConfig) (*Gossip, error) {
+	if config.ProbeInterval <= 0 {
+		config.ProbeInterval = time.Second
+	}
+	if config.ProbeTimeout <= 0 || config.ProbeTimeout >= config.ProbeInterval {
+		config.ProbeTimeout = config.ProbeInterval / 2
+	}
+	if config.IndirectProbes <= 0 {
+		config.IndirectProbes = 3
+	}
+	if config.SuspicionTimeout <= 0 {
+		config.SuspicionTimeout = 5 * config.ProbeInterval
+	}
+	if config.RetransmitMult <= 0 {
+		config.RetransmitMult = 4
+	}
+	if config.DeadTimeout <= 0 {
+		config.DeadTimeout = 30 * config.ProbeInterval
+	}
+	conn, err := net.ListenPacket("udp", config.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	if config.AdvertiseAddr == "" {
+		config.AdvertiseAddr = conn.LocalAddr().String()
+	}
+	if config.Name == "" {
+		config.Name = config.AdvertiseAddr
+	}
+	g := &Gossip{
+		config:  config,
+		conn:    conn,
+		self:    config.Name,
+		members: make(map[string]*member),
+		acks:    make(map[uint64]chan struct{}),
+		joined:  make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	self := &member{Member: Member{Name: config.Name, Addr: config.AdvertiseAddr, Meta: config.Meta}}
+	g.members[self.Name] = self
+	g.queue(self.toUpdate())
+
+	g.wg.Add(2)
+	go g.receiveLoop()
+	go g.probeLoop()
+	if len(config.Seeds) > 0 {
+		g.Join(config.Seeds...)
+	}
+	return g, nil
+}
+
+// Addr 返回其他节点访问自己使用的 UDP 地址
+func (g *Gossip) Addr() string {
+	return g.config.AdvertiseAddr
+}
+
+// Join 向种子节点发送完整的成员列表，对方回复它的成员列表，之后通过 gossip 逐渐传播到整个集群。
+// 种子节点可能还没有启动，没有收到回复也没有发现其他成员时在后台按指数退避重试，直到加入集群或 Close
+func (g *Gossip) Join(seeds ...string) {
+	g.sync(seeds)
+	go g.retryJoin(seeds)
+}
+
+func (g *Gossip) sync(seeds []string) {
+	state := g.fullState()
+	for _, seed := range seeds {
+		if seed != g.Addr() {
+			g.send(seed, &message{Type: msgSync, Updates: state})
+		}
+	}
+}
+
+// 重试间隔从 ProbeInterval 开始每次加倍，最多 maxJoinBackoff
+func (g *Gossip) retryJoin(seeds []string) {
+	backoff := g.config.ProbeInterval
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-g.joined:
+			timer.Stop()
+			return
+		case <-g.closed:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		g.sync(seeds)
+		if backoff *= 2; backoff > maxJoinBackoff {
+			backoff = maxJoinBackoff
+		}
+	}
+}
+
+// 已经加入集群，停止重试 Join
+func (g *Gossip) markJoined() {
+	g.joinOnce.Do(func() { close(g.joined) })
+}
+
+// Members 返回所有已知的成员，包括已经死亡但还没有超过 DeadTimeout 的成员，按名称排序
+func (g *Gossip) Members() []Member {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	members := make([]Member, 0, len(g.members))
+	for _, m := range g.members {
+		members = append(members, m.Member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+// Watch 在存活或被怀疑的成员变化时调用 update，传入它们的 Meta
+func (g *Gossip) Watch(ctx context.Context, update func(peers []string)) error {
+	changed := make(chan struct{}, 1)
+	g.mu.Lock()
+	g.watchers = append(g.watchers, changed)
+	g.mu.Unlock()
+	defer g.unwatch(changed)
+
+	var last []string
+	first := true
+	for {
+		if peers := g.peers(); first || !equal(peers, last) {
+			update(peers)
+			last, first = peers, false
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-g.closed:
+			return errors.New("discovery: gossip closed")
+		case <-changed:
+		}
+	}
+}
+
+func (g *Gossip) unwatch(changed chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, w := range g.watchers {
+		if w == changed {
+			g.watchers = append(g.watchers[:i], g.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (g *Gossip) peers() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var peers []string
+	for _, m := range g.members {
+		if m.State != StateDead && m.Meta != "" {
+			peers = append(peers, m.Meta)
+		}
+	}
+	return normalize(peers)
+}
+
+// Leave 广播自己离开集群后关闭，其他节点不需要等待故障检测就会移除该节点
+func (g *Gossip) Leave() error {
+	g.mu.Lock()
+	self := g.members[g.self]
+	self.Incarnation++
+	self.State = StateDead
+	leave := self.toUpdate()
+	targets := g.randomMembers(g.config.IndirectProbes+1, "")
+	g.mu.Unlock()
+	for _, m := range targets {
+		g.send(m.Addr, &message{Type: msgPing, Updates: []update{leave}})
+	}
+	return g.Close()
+}
+
+// Close 停止探测并关闭 UDP 连接，不通知其他节点，其他节点会通过故障检测发现
+func (g *Gossip) Close() error {
+	var err error
+	g.closeOnce.Do(func() {
+		close(g.closed)
+		err = g.conn.Close()
+		g.wg.Wait()
+	})
+	return err
+}
+
+func (g *Gossip) receiveLoop() {
+	defer g.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := g.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-g.closed:
+				return
+			default:
+				continue //UDP 的读错误一般是暂时的，例如收到 ICMP 不可达
+			}
+		}
+		data, ok := g.open(buf[:n])
+		if !ok {
+			continue //没有签名或签名错误，可能是伪造的消息
+		}
+		msg := new(message)
+		if err := json.Unmarshal(data, msg); err != nil {
+			continue
+		}
+		g.handle(msg, from.String())
+	}
+}
+
+func (g *Gossip) handle(msg *message, from string) {
+	for _, u := range msg.Updates {
+		g.apply(u)
+	}
+	switch msg.Type {
+	case msgPing:
+		if msg.Seq != 0 {
+			g.send(from, &message{Type: msgAck, Seq: msg.Seq})
+		}
+	case msgPingReq: //代为探测，收到 ack 后转发给请求方
+		ch, seq := g.expectAck()
+		g.send(msg.Target, &message{Type: msgPing, Seq: seq})
+		go func() {
+			defer g.forgetAck(seq)
+			select {
+			case <-ch:
+				g.send(from, &message{Type: msgAck, Seq: msg.Seq})
+			case <-time.After(g.config.ProbeTimeout):
+			case <-g.closed:
+			}
+		}()
+	case msgAck:
+		g.mu.Lock()
+		ch, ok := g.acks[msg.Seq]
+		g.mu.Unlock()
+		if ok {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	case msgSync:
+		g.send(from, &message{Type: msgSyncResp, Updates: g.fullState()})
+	case msgSyncResp:
+		g.markJoined()
+	}
+}
+
+// 合并一条状态变化：incarnation 更大的状态优先，相同时 dead > suspect > alive。
+// 状态确实发生变化时继续传播，并通知 Watch
+func (g *Gossip) apply(u update) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if u.Name == g.self {
+		g.refute(u)
+		return
+	}
+	m, ok := g.members[u.Name]
+	if !ok {
+		if u.State == StateDead {
+			return //不认识的节点已经死亡，不需要记录
+		}
+		m = &member{Member: Member{Name: u.Name, Addr: u.Addr, Meta: u.Meta, Incarnation: u.Incarnation, State: u.State}}
+		if u.State == StateSuspect {
+			m.suspectAt = time.Now()
+		}
+		g.members[u.Name] = m
+		g.queue(u)
+		g.notify()
+		g.markJoined()
+		return
+	}
+	if u.Incarnation < m.Incarnation || (u.Incarnation == m.Incarnation && u.State <= m.State) {
+		return //旧的消息
+	}
+	if m.State == StateDead && u.State == StateDead {
+		m.Incarnation = u.Incarnation
+		return
+	}
+	if u.State == StateSuspect && m.State != StateSuspect {
+		m.suspectAt = time.Now()
+	}
+	if u.State == StateDead {
+		m.deadAt = time.Now()
+	}
+	m.Addr, m.Meta, m.Incarnation, m.State = u.Addr, u.Meta, u.Incarnation, u.State
+	g.queue(u)
+	g.notify()
+}
+
+// 其他节点怀疑自己或认为自己已经死亡时，增大 incarnation 广播 alive 反驳；调用时已经持有 mu
+func (g *Gossip) refute(u update) {
+	self := g.members[g.self]
+	if u.State == StateAlive || u.Incarnation < self.Incarnation || self.State == StateDead {
+		return //离开后不再反驳
+	}
+	self.Incarnation = u.Incarnation + 1
+	g.queue(self.toUpdate())
+}
+
+func (g *Gossip) probeLoop() {
+	defer g.wg.Done()
+	ticker := time.NewTicker(g.config.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.closed:
+			return
+		case <-ticker.C:
+		}
+		g.expireSuspects()
+		g.reapDead()
+		if target := g.nextProbeTarget(); target != nil {
+			g.probe(target)
+		}
+	}
+}
+
+// 依次探测打乱顺序后的成员，一轮结束后重新打乱
+func (g *Gossip) nextProbeTarget() *Member {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for attempts := 0; attempts < 2; attempts++ {
+		for len(g.probeOrder) > 0 {
+			name := g.probeOrder[0]
+			g.probeOrder = g.probeOrder[1:]
+			if m, ok := g.members[name]; ok && m.State != StateDead && name != g.self {
+				target := m.Member
+				return &target
+			}
+		}
+		for name, m := range g.members {
+			if name != g.self && m.State != StateDead {
+				g.probeOrder = append(g.probeOrder, name)
+			}
+		}
+		rand.Shuffle(len(g.probeOrder), func(i, j int) {
+			g.probeOrder[i], g.probeOrder[j] = g.probeOrder[j], g.probeOrder[i]
+		})
+	}
+	return nil
+}
+
+func (g *Gossip) probe(target *Member) {
+	ch, seq := g.expectAck()
+	defer g.forgetAck(seq)
+	g.send(target.Addr, &message{Type: msgPing, Seq: seq})
+	if g.wait(ch, g.config.ProbeTimeout) {
+		return
+	}
+	//直接探测超时，请其他节点代为探测，排除网络中单条链路的问题
+	g.mu.Lock()
+	relays := g.randomMembers(g.config.IndirectProbes, target.Name)
+	g.mu.Unlock()
+	for _, relay := range relays {
+		g.send(relay.Addr, &message{Type: msgPingReq, Seq: seq, Target: target.Addr})
+	}
+	if g.wait(ch, g.config.ProbeInterval-g.config.ProbeTimeout) {
+		return
+	}
+	g.apply(update{Name: target.Name, Addr: target.Addr, Meta: target.Meta, Incarnation: target.Incarnation, State: StateSuspect})
+}
+
+func (g *Gossip) wait(ch chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+		return false
+	case <-g.closed:
+		return true
+	}
+}
+
+// 怀疑超时的成员判定为死亡
+func (g *Gossip) expireSuspects() {
+	g.mu.Lock()
+	var expired []update
+	for _, m := range g.members {
+		if m.State == StateSuspect && time.Since(m.suspectAt) >= g.config.SuspicionTimeout {
+			u := m.toUpdate()
+			u.State = StateDead
+			expired = append(expired, u)
+		}
+	}
+	g.mu.Unlock()
+	for _, u := range expired {
+		g.apply(u)
+	}
+}
+
+// 死亡超过 DeadTimeout 的成员从列表中删除，此时判定死亡的消息已经传播完毕
+func (g *Gossip) reapDead() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for name, m := range g.members {
+		if name != g.self && m.State == StateDead && time.Since(m.deadAt) >= g.config.DeadTimeout {
+			delete(g.members, name)
+		}
+	}
+}
+
+func (g *Gossip) expectAck() (chan struct{}, uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.seq++
+	ch := make(chan struct{}, 1)
+	g.acks[g.seq] = ch
+	return ch, g.seq
+}
+
+func (g *Gossip) forgetAck(seq uint64) {
+	g.mu.Lock()
+	delete(g.acks, seq)
+	g.mu.Unlock()
+}
+
+// 随机选择最多 n 个存活的成员，排除自己和 exclude；调用时已经持有 mu
+func (g *Gossip) randomMembers(n int, exclude string) []Member {
+	var candidates []Member
+	for name, m := range g.members {
+		if name != g.self && name != exclude && m.State == StateAlive {
+			candidates = append(candidates, m.Member)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// 加入等待捎带的队列，同一个成员只保留最新的状态；调用时已经持有 mu
+func (g *Gossip) queue(u update) {
+	for i, b := range g.broadcasts {
+		if b.update.Name == u.Name {
+			g.broadcasts = append(g.broadcasts[:i], g.broadcasts[i+1:]...)
+			break
+		}
+	}
+	g.broadcasts = append(g.broadcasts, &broadcast{update: u})
+}
+
+// 取出发送次数最少的若干状态变化，发送足够多次后从队列中删除
+func (g *Gossip) piggyback() []update {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.broadcasts) == 0 {
+		return nil
+	}
+	limit := g.config.RetransmitMult * int(math.Ceil(math.Log2(float64(len(g.members)+1))))
+	sort.SliceStable(g.broadcasts, func(i, j int) bool { return g.broadcasts[i].transmits < g.broadcasts[j].transmits })
+	n := len(g.broadcasts)
+	if n > maxPiggyback {
+		n = maxPiggyback
+	}
+	updates := make([]update, n)
+	kept := g.broadcasts[:0]
+	for i, b := range g.broadcasts {
+		if i < n {
+			updates[i] = b.update
+			b.transmits++
+		}
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	g.broadcasts = kept
+	return updates
+}
+
+// 包括死亡成员在内的全部状态，新节点据此得知自己曾被判定死亡并反驳
+func (g *Gossip) fullState() []update {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state := make([]update, 0, len(g.members))
+	for _, m := range g.members {
+		state = append(state, m.toUpdate())
+	}
+	return state
+}
+
+// 通知所有 Watch，调用时已经持有 mu
+func (g *Gossip) notify() {
+	for _, w := range g.watchers {
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 发送消息并捎带状态变化，UDP 发送失败由故障检测兜底，这里忽略错误
+func (g *Gossip) send(addr string, msg *message) {
+	msg.Updates = append(msg.Updates, g.piggyback()...)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	data = g.seal(data)
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return
+	}
+	g.conn.WriteTo(data, udpAddr)
+}
+
+// 设置了 SecretKey 时在消息前面加上签名：HMAC-SHA256(SecretKey, 消息) + 消息
+func (g *Gossip) seal(data []byte) []byte {
+	if len(g.config.SecretKey) == 0 {
+		return data
+	}
+	mac := hmac.New(sha256.New, g.config.SecretKey)
+	mac.Write(data)
+	return append(mac.Sum(nil), data...)
+}
+
+// 校验并去掉签名，返回消息本身；没有设置 SecretKey 时原样返回
+func (g *Gossip) open(packet []byte) ([]byte, bool) {
+	if len(g.config.SecretKey) == 0 {
+		return packet, true
+	}
+	if len(packet) < sha256.Size {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, g.config.SecretKey)
+	mac.Write(packet[sha256.Size:])
+	return packet[sha256.Size:], hmac.Equal(packet[:sha256.Size], mac.Sum(nil))
+}
+
+func (m *member) toUpdate() update {
+	return update{Name: m.Name, Addr: m.Addr, Meta: m.Meta, Incarnation: m.Incarnation, State: m.State}
+}
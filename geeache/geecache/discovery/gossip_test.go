@@ -0,0 +1,175 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testGossipConfig(i int, seeds ...string) GossipConfig {
+	return GossipConfig{
+		BindAddr:         "127.0.0.1:0",
+		Meta:             fmt.Sprintf("http://node%d", i),
+		Seeds:            seeds,
+		ProbeInterval:    20 * time.Millisecond,
+		ProbeTimeout:     10 * time.Millisecond,
+		SuspicionTimeout: 100 * time.Millisecond,
+	}
+}
+
+func newTestGossip(t *testing.T, i int, seeds ...string) *Gossip {
+	return newTestGossipConfig(t, testGossipConfig(i, seeds...))
+}
+
+func newTestGossipConfig(t *testing.T, config GossipConfig) *Gossip {
+	g, err := NewGossip(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestGossip(t *testing.T) {
+	g1 := newTestGossip(t, 1)
+	defer g1.Close()
+	g2 := newTestGossip(t, 2, g1.Addr())
+	defer g2.Close()
+	g3 := newTestGossip(t, 3, g1.Addr())
+	defer g3.Close()
+
+	all := []string{"http://node1", "http://node2", "http://node3"}
+	r, cancel, _ := watch(g2)
+	defer cancel()
+	for _, g := range []*Gossip{g1, g2, g3} {
+		g := g
+		eventually(t, 2*time.Second, func() bool { return reflect.DeepEqual(g.peers(), all) },
+			"%s 应该发现所有节点，got %v", g.Addr(), g.peers())
+	}
+	eventually(t, time.Second, func() bool { return reflect.DeepEqual(r.last(), all) }, "Watch 应该通知全部节点，got %v", r.last())
+
+	//g3 异常退出，经过怀疑阶段后被判定为死亡
+	g3.Close()
+	eventually(t, 2*time.Second, func() bool {
+		return reflect.DeepEqual(g1.peers(), all[:2]) && reflect.DeepEqual(g2.peers(), all[:2])
+	}, "g3 应该被判定为死亡，got %v %v", g1.peers(), g2.peers())
+	eventually(t, time.Second, func() bool { return reflect.DeepEqual(r.last(), all[:2]) }, "Watch 应该通知 g3 离开，got %v", r.last())
+	for _, m := range g1.Members() {
+		if m.Meta == "http://node3" && m.State != StateDead {
+			t.Fatalf("g3 的状态应该是 dead，got %v", m.State)
+		}
+	}
+}
+
+// 被误判为 suspect 的节点增大 incarnation 反驳，不会被移除
+func TestGossipRefute(t *testing.T) {
+	g1 := newTestGossip(t, 1)
+	defer g1.Close()
+	g2 := newTestGossip(t, 2, g1.Addr())
+	defer g2.Close()
+	eventually(t, 2*time.Second, func() bool { return len(g1.peers()) == 2 && len(g2.peers()) == 2 }, "两个节点应该互相发现")
+
+	g1.apply(update{Name: g2.self, Addr: g2.Addr(), Meta: "http://node2", State: StateSuspect})
+	eventually(t, 2*time.Second, func() bool {
+		for _, m := range g1.Members() {
+			if m.Name == g2.self {
+				return m.State == StateAlive && m.Incarnation > 0
+			}
+		}
+		return false
+	}, "g2 应该反驳怀疑，got %v", g1.Members())
+	time.Sleep(200 * time.Millisecond) //超过 SuspicionTimeout 也不会被判定死亡
+	if len(g1.peers()) != 2 {
+		t.Fatalf("反驳之后 g2 不应该被移除，got %v", g1.Members())
+	}
+}
+
+func TestGossipLeave(t *testing.T) {
+	g1 := newTestGossip(t, 1)
+	defer g1.Close()
+	g2 := newTestGossip(t, 2, g1.Addr())
+	eventually(t, 2*time.Second, func() bool { return len(g1.peers()) == 2 }, "两个节点应该互相发现")
+
+	start := time.Now()
+	g2.Leave()
+	eventually(t, time.Second, func() bool { return len(g1.peers()) == 1 }, "g2 离开后应该被移除")
+	if time.Since(start) >= 100*time.Millisecond {
+		t.Fatalf("主动离开不需要等待怀疑超时")
+	}
+}
+
+// 先于种子节点启动的节点不断重试 Join，种子节点启动后加入集群
+func TestGossipJoinRetry(t *testing.T) {
+	g1 := newTestGossip(t, 1)
+	seed := g1.Addr()
+	g1.Close() //seed 地址暂时没有节点监听
+
+	g2 := newTestGossip(t, 2, seed)
+	defer g2.Close()
+	time.Sleep(50 * time.Millisecond)
+	g3, err := NewGossip(GossipConfig{
+		BindAddr:      seed,
+		Meta:          "http://node3",
+		ProbeInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g3.Close()
+	eventually(t, 2*time.Second, func() bool { return len(g2.peers()) == 2 && len(g3.peers()) == 2 },
+		"种子节点启动后应该加入集群，got %v %v", g2.peers(), g3.peers())
+}
+
+// 设置 SecretKey 后，没有密钥或密钥不同的节点发来的消息都被丢弃，不能注入成员
+func TestGossipSecretKey(t *testing.T) {
+	config := testGossipConfig(1)
+	config.SecretKey = []byte("secret")
+	g1 := newTestGossipConfig(t, config)
+	defer g1.Close()
+	config = testGossipConfig(2, g1.Addr())
+	config.SecretKey = []byte("secret")
+	g2 := newTestGossipConfig(t, config)
+	defer g2.Close()
+	config = testGossipConfig(3, g1.Addr())
+	config.SecretKey = []byte("wrong")
+	g3 := newTestGossipConfig(t, config)
+	defer g3.Close()
+	g4 := newTestGossip(t, 4, g1.Addr())
+	defer g4.Close()
+
+	//直接发送没有签名的 sync 消息伪造成员
+	conn, err := net.Dial("udp", g1.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data, _ := json.Marshal(&message{Type: msgSync, Updates: []update{{Name: "evil", Addr: "127.0.0.1:1", Meta: "http://evil"}}})
+	conn.Write(data)
+	time.Sleep(50 * time.Millisecond) //伪造的成员如果被接受，判定死亡之前仍然会出现在成员列表中
+	for _, m := range g1.Members() {
+		if m.Meta != "http://node1" && m.Meta != "http://node2" {
+			t.Fatalf("没有正确签名的节点不能加入，got %v", g1.Members())
+		}
+	}
+
+	eventually(t, 2*time.Second, func() bool { return len(g1.peers()) == 2 && len(g2.peers()) == 2 }, "相同密钥的节点应该互相发现")
+	if len(g3.peers()) != 1 || len(g4.peers()) != 1 {
+		t.Fatalf("密钥不同的节点不应该收到成员列表，got %v %v", g3.peers(), g4.peers())
+	}
+}
+
+// 死亡的成员超过 DeadTimeout 后从成员列表中删除
+func TestGossipReapDead(t *testing.T) {
+	config := testGossipConfig(1)
+	config.DeadTimeout = 100 * time.Millisecond
+	g1 := newTestGossipConfig(t, config)
+	defer g1.Close()
+	g2 := newTestGossip(t, 2, g1.Addr())
+	eventually(t, 2*time.Second, func() bool { return len(g1.peers()) == 2 }, "两个节点应该互相发现")
+
+	g2.Leave()
+	eventually(t, time.Second, func() bool { return len(g1.peers()) == 1 }, "g2 离开后应该被移除")
+	eventually(t, time.Second, func() bool { return len(g1.Members()) == 1 }, "死亡的 g2 应该被删除，got %v", g1.Members())
+}
@@ -4,9 +4,11 @@ package geecache
 */
 import (
 	"fmt"
+	"geecache/policy"
 	"geecache/singleflight"
-	"log"
+	"math/rand"
 	"sync"
+	"time"
 	pb "geecache/geecachepb"
 )
 
@@ -29,9 +31,26 @@ Group 是 GeeCache 最核心的数据结构,负责与用户的交互，并且控
 type Group struct {
 	name      string
 	getter    Getter //缓存未命中时获取源数据的回调(callback)，接口作为参数，便于扩展（接口内新增方法）
-	mainCache cache  //一开始实现的并发缓存(分布式中本地分配到的cache部分)
+	mainCache cacher //一开始实现的并发缓存(分布式中本地分配到的cache部分)，通过 WithShards 分段
+	//hotCache 保存从远程节点获取的热点数据的副本，避免热点 key 的请求全部打到所属节点上。
+	//只有一部分远程获取的值会被保存，越热的 key 越可能进入 hotCache
+	hotCache      cache
+	cacheBytes    int64 //mainCache 与 hotCache 共用的内存上限，为 0 时 mainCache 不限制，hotCache 仍有自己的上限
+	hotCacheRatio int   //远程获取的值以 1/hotCacheRatio 的概率放入 hotCache，<= 0 时不使用 hotCache
+	stats         groupStats //命中率等统计信息，通过 Stats() 读取
+	newStore      policy.Factory //mainCache 与 hotCache 使用的淘汰策略，为 nil 时使用 LRU
+	shards        int //mainCache 的分段数，<= 1 时不分段
+	maxEntries    int //mainCache 的最大记录数，0 表示不限制
 	peers     PeerPicker //储存实现了 PeerPicker 接口的 HTTPPool
 	loader *singleflight.Group //确保每个key只被获取一次
+	logger    Logger     //默认不输出日志，通过 WithLogger 替换
+
+	defaultTTL      time.Duration    //回调函数没有指定有效期时使用的默认有效期，0 表示永不过期
+	now             func() time.Time //判断过期使用的时钟，测试时通过 WithClock 替换
+	janitorInterval time.Duration    //后台清理过期缓存的间隔，<= 0 时只在访问时惰性删除
+	janitorOnce     sync.Once        //第一次写入带有效期的缓存时才启动后台清理
+	stopJanitor     chan struct{}
+	closeOnce       sync.Once
 }
 
 type Getter interface {
@@ -49,23 +68,68 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key) //调用自己
 }
 
+// TTLGetter 在返回源数据的同时指定缓存的有效期：ttl 为 0 时使用 Group 的默认有效期，小于 0 时永不过期
+type TTLGetter interface {
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// TTLGetterFunc 同时实现了 Getter 和 TTLGetter，可以直接传给 NewGroup
+type TTLGetterFunc func(key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(key)
+	return bytes, err
+}
+
 var (
 	mu     sync.RWMutex //读写互斥锁
 	groups = make(map[string]*Group)
 ) //初始化全局变量
 
-//实例化 Group，并且将 group 存储在全局变量 groups 中
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+//实例化 Group，并且将 group 存储在全局变量 groups 中，opts 用于设置默认有效期等可选项
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
+	g := &Group{
+		name:            name,
+		getter:          getter,
+		hotCache:        cache{cacheBytes: defaultHotCache(cacheBytes)},
+		cacheBytes:      cacheBytes,
+		hotCacheRatio:   defaultHotCacheRatio,
+		loader:          &singleflight.Group{},
+		logger:          NopLogger,
+		now:             time.Now,
+		janitorInterval: defaultJanitorInterval,
+		stopJanitor:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.maxEntries > 0 && g.newStore != nil {
+		if _, ok := g.newStore(0, nil, nil).(policy.EntryLimiter); !ok {
+			g.logger.Log(LevelWarn, "淘汰策略没有实现 policy.EntryLimiter，WithMaxEntries 不会生效", "group", name)
+		}
+	}
+	if g.shards > 1 {
+		s := newShardedCache(g.shards, cacheBytes, g.maxEntries, g.newStore, g.now)
+		if len(s.shards) < g.shards {
+			g.logger.Log(LevelWarn, "cacheBytes 或 maxEntries 不足以分为这么多段，减少了段数", "group", name, "shards", len(s.shards))
+		}
+		g.mainCache = s
+	} else {
+		g.mainCache = &cache{cacheBytes: cacheBytes, maxEntries: g.maxEntries, newStore: g.newStore, now: g.now}
+	}
+	g.hotCache.newStore = g.newStore
+	g.hotCache.now = g.now
 	mu.Lock() //加写锁
 	defer mu.Unlock()
-	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+	if old, ok := groups[name]; ok {
+		old.Close() //同名的旧 Group 被替换，停止它的后台清理
 	}
 	groups[name] = g
 	return g
@@ -86,9 +150,20 @@ func (g *Group) Get(key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	g.stats.gets.Add(1)
 
 	if v, ok := g.mainCache.get(key); ok { //从 mainCache 中查找缓存，如果存在则返回缓存值
-		log.Printf("从mainCache中查找到%v对应缓存:%v\n",key,v)
+		if g.logger.Enabled(LevelDebug) { //热点路径，先判断级别再准备参数
+			g.logger.Log(LevelDebug, "mainCache 命中", "group", g.name, "key", key, "bytes", v.Len())
+		}
+		g.stats.hits.Add(1)
+		return v, nil
+	}
+	if v, ok := g.hotCache.get(key); ok { //远程节点的热点数据在本地的副本
+		if g.logger.Enabled(LevelDebug) {
+			g.logger.Log(LevelDebug, "hotCache 命中", "group", g.name, "key", key, "bytes", v.Len())
+		}
+		g.stats.hits.Add(1)
 		return v, nil
 	}
 
@@ -107,21 +182,30 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 //使用 PickPeer() 方法选择节点，若非本机节点，则调用 getFromPeer() 从远程获取。若是本机节点或失败，则回退到 getLocally()
 func (g *Group) load(key string) (value ByteView, err error) {
 	//每个key只被获取一次(本地或远程),不考虑并发调用者的数量
+	executed := false //没有执行回调说明本次调用被 singleflight 合并
 	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+		executed = true
 		if g.peers != nil {
-			fmt.Printf("g.peers存有HTTPPool:%v\n",g.peers)
 			if peer, ok := g.peers.PickPeer(key); ok { //获取一个客户端对象
-				fmt.Printf("真实节点对应客户端对象(通讯地址):%v\n",peer)
 				if value, err = g.getFromPeer(peer, key); err == nil { //此处从远端获取缓存后，并没有储存到 mainCache 缓存
-					fmt.Printf("使用客户端访问远程节点获取到缓存值:%v\n",value)
+					if g.logger.Enabled(LevelDebug) {
+						g.logger.Log(LevelDebug, "从远程节点获取缓存", "group", g.name, "key", key, "peer", peer, "bytes", value.Len())
+					}
+					g.stats.peerLoads.Add(1)
+					if g.hotCacheRatio > 0 && rand.Intn(g.hotCacheRatio) == 0 { //只按一定概率存入 hotCache
+						g.populateHotCache(key, value)
+					}
 					return value, nil
 				}
-				log.Println("客户端获取失败", err)
+				g.stats.peerErrors.Add(1)
+				g.logger.Log(LevelWarn, "从远程节点获取失败，回退到本地", "group", g.name, "key", key, "peer", peer, "err", err)
 			}
 		}
-		fmt.Println("开始从本地回调函数获取缓存值")
 		return g.getLocally(key)
 	})
+	if !executed {
+		g.stats.loadsDeduped.Add(1)
+	}
 	if err == nil {
 		return viewi.(ByteView), nil
 	}
@@ -129,23 +213,110 @@ func (g *Group) load(key string) (value ByteView, err error) {
 }
 
 //将键值对存储到 mainCache 缓存中，然后将更新后的值返回给调用者
-func (g *Group) populateCache(key string, value ByteView) {
-	fmt.Println("将本地数据源存入缓存")
-	g.mainCache.add(key, value)
+func (g *Group) populateCache(key string, value ByteView, ttl time.Duration) {
+	expire := g.expireAt(ttl)
+	if !expire.IsZero() {
+		g.startJanitor()
+	}
+	g.mainCache.add(key, value, expire)
+	g.shrinkCaches()
+}
+
+// 远程节点的值放入 hotCache，使用默认有效期
+func (g *Group) populateHotCache(key string, value ByteView) {
+	expire := g.expireAt(0)
+	if !expire.IsZero() {
+		g.startJanitor()
+	}
+	g.hotCache.add(key, value, expire)
+	g.shrinkCaches()
+}
+
+// 两个缓存共用 cacheBytes：超出时淘汰 mainCache，hotCache 超过 mainCache 的 1/8 时优先淘汰 hotCache
+func (g *Group) shrinkCaches() {
+	if g.cacheBytes <= 0 {
+		return
+	}
+	for {
+		mainBytes, hotBytes := g.mainCache.bytes(), g.hotCache.bytes()
+		if mainBytes+hotBytes <= g.cacheBytes {
+			return
+		}
+		victim := g.mainCache
+		if hotBytes > mainBytes/8 {
+			victim = &g.hotCache
+		}
+		victim.removeOldest()
+	}
 }
 
 //调用用户注册的回调函数回填缓存
 func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key) //调用用户回调函数(可能是从数据库中加载数据)获取源数据，创建一条缓存值记录
-	fmt.Printf("得到[]byte处理后的本地数据源:%v err: %v\n",bytes,err)
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	//调用用户回调函数(可能是从数据库中加载数据)获取源数据，创建一条缓存值记录
+	if tg, ok := g.getter.(TTLGetter); ok {
+		bytes, ttl, err = tg.GetWithTTL(key)
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
+		g.stats.localLoadErrs.Add(1)
+		g.logger.Log(LevelWarn, "回调函数获取源数据失败", "group", g.name, "key", key, "err", err)
 		return ByteView{}, err
 	}
+	g.stats.localLoads.Add(1)
+	if g.logger.Enabled(LevelDebug) {
+		g.logger.Log(LevelDebug, "从本地回调函数获取源数据", "group", g.name, "key", key, "bytes", len(bytes), "ttl", ttl)
+	}
 	value := ByteView{b: cloneBytes(bytes)} //bytes是切片，切片不会深拷贝
-	g.populateCache(key, value)
+	g.populateCache(key, value, ttl)
 	return value, nil
 }
 
+// 根据有效期计算过期时间：ttl 为 0 时使用默认有效期，最终有效期 <= 0 时返回零值(永不过期)
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl == 0 {
+		ttl = g.defaultTTL
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return g.now().Add(ttl)
+}
+
+// 后台定期清理过期缓存，避免不再被访问的过期数据一直占用内存
+func (g *Group) startJanitor() {
+	if g.janitorInterval <= 0 {
+		return
+	}
+	g.janitorOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(g.janitorInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					g.mainCache.removeExpired()
+					g.hotCache.removeExpired()
+				case <-g.stopJanitor:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Close 停止后台清理，Group 仍然可以使用，过期的缓存在访问时惰性删除
+func (g *Group) Close() {
+	g.closeOnce.Do(func() {
+		close(g.stopJanitor)
+	})
+}
+
 //使用实现了 PeerGetter 接口的 httpGetter 访问远程节点，获取缓存值
 func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 	//bytes, err := peer.Get(g.name, key)
@@ -168,3 +339,107 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 	//原来的bytes由res.Value( 由(h *httpGetter) Get方法中中生成 )提供
 	return ByteView{b: res.Value}, nil
 }
+
+// Set 在数据源更新后写入新值。配置了节点时写入 key 所属的节点，并通知其他节点删除可能存在的旧副本；
+// 所属节点写入失败时返回错误，通知其他节点失败只记录日志
+func (g *Group) Set(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	owner, err := g.routeToOwner(key, func(peer PeerGetter, req *pb.Request) error {
+		req.Value = value
+		return peer.Set(req, &pb.Response{})
+	})
+	if err != nil {
+		return err
+	}
+	if owner == nil {
+		g.setLocally(key, value)
+	} else {
+		g.removeLocally(key) //本地可能有回退时写入的旧值
+	}
+	g.broadcast(owner, func(peer PeerGetter) error {
+		return peer.Remove(&pb.Request{Group: g.name, Key: key}, &pb.Response{})
+	})
+	return nil
+}
+
+// Remove 删除 key 的缓存，下次访问时重新调用回调函数加载。
+// 配置了节点时先删除所属节点的缓存，再通知其他节点删除副本
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	remove := func(peer PeerGetter, req *pb.Request) error {
+		return peer.Remove(req, &pb.Response{})
+	}
+	owner, err := g.routeToOwner(key, remove)
+	if err != nil {
+		return err
+	}
+	g.removeLocally(key)
+	g.broadcast(owner, func(peer PeerGetter) error {
+		return remove(peer, &pb.Request{Group: g.name, Key: key})
+	})
+	return nil
+}
+
+// Purge 清空本节点和所有其他节点(PeerPicker 实现了 PeerLister 时)上该 Group 的缓存，返回第一个失败节点的错误
+func (g *Group) Purge() error {
+	g.purgeLocally()
+	var first error
+	g.broadcast(nil, func(peer PeerGetter) error {
+		err := peer.Purge(&pb.Request{Group: g.name}, &pb.Response{})
+		if err != nil && first == nil {
+			first = err
+		}
+		return err
+	})
+	return first
+}
+
+// key 属于远程节点时对它执行 op，返回该节点；属于本节点或没有配置节点时返回 nil
+func (g *Group) routeToOwner(key string, op func(peer PeerGetter, req *pb.Request) error) (PeerGetter, error) {
+	if g.peers == nil {
+		return nil, nil
+	}
+	peer, ok := g.peers.PickPeer(key)
+	if !ok {
+		return nil, nil
+	}
+	if err := op(peer, &pb.Request{Group: g.name, Key: key}); err != nil {
+		return nil, fmt.Errorf("owner peer: %v", err)
+	}
+	return peer, nil
+}
+
+// 依次对除 skip 以外的其他节点执行 op，失败时记录日志；PeerPicker 没有实现 PeerLister 时什么也不做
+func (g *Group) broadcast(skip PeerGetter, op func(peer PeerGetter) error) {
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return
+	}
+	for _, peer := range lister.GetAll() {
+		if peer == skip {
+			continue
+		}
+		if err := op(peer); err != nil {
+			g.logger.Log(LevelWarn, "通知节点失败", "group", g.name, "peer", peer, "err", err)
+		}
+	}
+}
+
+// 写入本地缓存，使用默认有效期
+func (g *Group) setLocally(key string, value []byte) {
+	g.populateCache(key, ByteView{b: cloneBytes(value)}, 0)
+}
+
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+}
+
+func (g *Group) purgeLocally() {
+	g.mainCache.purge()
+	g.hotCache.purge()
+}
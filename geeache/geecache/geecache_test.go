@@ -4,7 +4,14 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	pb "geecache/geecachepb"
+	"geecache/lru"
+	"geecache/policy"
 )
 
 //模拟耗时的数据库
@@ -72,4 +79,361 @@ func TestGetGroup(t *testing.T) {
 	if group := GetGroup(groupName + "111"); group != nil {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
-}
\ No newline at end of file
+}
+
+// 可以手动拨动的时钟，janitor 在另一个 goroutine 中读取，需要加锁
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	loads := make(map[string]int)
+	var loadsMu sync.Mutex
+	g := NewGroup("ttl", 2<<10, TTLGetterFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loadsMu.Lock()
+			loads[key]++
+			loadsMu.Unlock()
+			switch key {
+			case "short":
+				return []byte("1"), time.Second, nil
+			case "forever":
+				return []byte("2"), -1, nil
+			}
+			return []byte("3"), 0, nil //使用默认有效期
+		}), WithDefaultTTL(time.Minute), WithClock(clock.Now), WithJanitorInterval(time.Millisecond))
+	defer g.Close()
+
+	for _, key := range []string{"short", "default", "forever"} {
+		g.Get(key)
+		g.Get(key)
+	}
+	clock.Advance(2 * time.Second)
+	for _, key := range []string{"short", "default", "forever"} {
+		g.Get(key)
+	}
+	if loads["short"] != 2 || loads["default"] != 1 || loads["forever"] != 1 {
+		t.Fatalf("只有 short 应该过期后重新加载，got %v", loads)
+	}
+
+	//default 与 short 都过期后，不再访问也会被后台清理
+	clock.Advance(time.Hour)
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := g.mainCache.stats().Items
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor 应该清理掉过期的缓存，剩余 %d 个", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	g := NewGroup("policy-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithPolicy(policy.TinyLFU))
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i%300)
+		if v, err := g.Get(key); err != nil || v.String() != key {
+			t.Fatalf("Get(%s) = %q, %v", key, v.String(), err)
+		}
+	}
+	if b := g.mainCache.bytes(); b == 0 || b > 2<<10 {
+		t.Fatalf("mainCache 使用了 %d 字节", b)
+	}
+	if _, ok := g.mainCache.(*cache).store.(*lru.Cache); ok {
+		t.Fatalf("WithPolicy 没有生效")
+	}
+}
+
+func TestWithMaxEntries(t *testing.T) {
+	stores := []policy.Factory{nil, policy.LFU, policy.ARC, policy.TwoQueue, policy.TinyLFU}
+	for i, newStore := range stores {
+		for _, shards := range []int{1, 2} {
+			name := "max-entries-" + strconv.Itoa(i) + "-" + strconv.Itoa(shards)
+			g := NewGroup(name, 0, GetterFunc(func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}), WithPolicy(newStore), WithShards(shards), WithMaxEntries(10))
+			for j := 0; j < 100; j++ {
+				g.Get("key" + strconv.Itoa(j))
+			}
+			if st := g.Stats().MainCache; st.Items > 10 || st.Items == 0 || st.Evictions == 0 {
+				t.Fatalf("%s: 记录数应该限制在 10 条以内，got %+v", name, st)
+			}
+		}
+
+		//只限制记录数时仍然保留各策略的抗扫描能力：一次性扫描大量 key 之后，反复访问的热点 key 仍在缓存中
+		g := NewGroup("max-entries-scan-"+strconv.Itoa(i), 0, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithPolicy(newStore), WithMaxEntries(100))
+		for round := 0; round < 5; round++ {
+			for j := 0; j < 20; j++ {
+				g.Get("hot" + strconv.Itoa(j))
+			}
+		}
+		for j := 0; j < 1000; j++ {
+			g.Get("scan" + strconv.Itoa(j))
+		}
+		kept := 0
+		for j := 0; j < 20; j++ {
+			if _, ok := g.mainCache.get("hot" + strconv.Itoa(j)); ok {
+				kept++
+			}
+		}
+		if newStore == nil && kept != 0 {
+			t.Fatalf("LRU 在扫描后不应该保留热点 key，kept %d", kept)
+		}
+		if newStore != nil && kept < 18 {
+			t.Fatalf("policy %d: 扫描之后应该保留热点 key，只剩 %d 个", i, kept)
+		}
+	}
+}
+
+// 进程内模拟的远程节点，直接调用对方 Group 的本地方法
+type fakePeer struct {
+	g    *Group
+	gets int
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	p.gets++
+	v, err := p.g.Get(in.GetKey())
+	out.Value = v.ByteSlice()
+	return err
+}
+
+func (p *fakePeer) Set(in *pb.Request, out *pb.Response) error {
+	p.g.setLocally(in.GetKey(), in.GetValue())
+	return nil
+}
+
+func (p *fakePeer) Remove(in *pb.Request, out *pb.Response) error {
+	p.g.removeLocally(in.GetKey())
+	return nil
+}
+
+func (p *fakePeer) Purge(in *pb.Request, out *pb.Response) error {
+	p.g.purgeLocally()
+	return nil
+}
+
+// owners 指定 key 所属的节点，不在其中的 key 属于自己
+type fakePicker struct {
+	owners map[string]PeerGetter
+	others []PeerGetter
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	peer, ok := p.owners[key]
+	return peer, ok
+}
+
+func (p *fakePicker) GetAll() []PeerGetter { return p.others }
+
+// 只实现 PeerPicker 的节点选择器，不支持广播
+type pickOnly struct{ owners map[string]PeerGetter }
+
+func (p pickOnly) PickPeer(key string) (PeerGetter, bool) {
+	peer, ok := p.owners[key]
+	return peer, ok
+}
+
+func TestPickerWithoutLister(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	owner := NewGroup("lister-owner", 2<<10, getter)
+	g := NewGroup("lister", 2<<10, getter)
+	g.RegisterPeers(pickOnly{owners: map[string]PeerGetter{"Tom": &fakePeer{g: owner}}})
+
+	owner.Get("Tom")
+	if err := g.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := owner.mainCache.get("Tom"); ok {
+		t.Fatalf("Remove 应该删除所属节点上的缓存")
+	}
+	g.Get("Jack")
+	if err := g.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("Jack"); ok {
+		t.Fatalf("Purge 应该清空本节点")
+	}
+}
+
+func TestSetRemovePurge(t *testing.T) {
+	source := map[string]string{"Tom": "630", "Jack": "589"}
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := source[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	})
+	a := NewGroup("peers-a", 2<<10, getter)
+	b := NewGroup("peers-b", 2<<10, getter)
+	peerA, peerB := &fakePeer{g: a}, &fakePeer{g: b}
+	//Tom 属于 b，Jack 属于 a
+	a.RegisterPeers(&fakePicker{owners: map[string]PeerGetter{"Tom": peerB}, others: []PeerGetter{peerB}})
+	b.RegisterPeers(&fakePicker{owners: map[string]PeerGetter{"Jack": peerA}, others: []PeerGetter{peerA}})
+
+	if v, _ := a.Get("Tom"); v.String() != "630" {
+		t.Fatalf("Tom 应该从 b 获取，got %q", v)
+	}
+	b.mainCache.add("Jack", ByteView{b: []byte("589")}, time.Time{}) //模拟 a 不可用时 b 回退加载的副本
+
+	source["Tom"] = "700"
+	if err := a.Set("Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := b.mainCache.get("Tom"); !ok || v.String() != "700" {
+		t.Fatalf("Set 应该写入所属节点 b，got %q", v)
+	}
+
+	source["Jack"] = "600"
+	if err := b.Set("Jack", []byte("600")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.mainCache.get("Jack"); ok {
+		t.Fatalf("Set 应该删除非所属节点上的旧副本")
+	}
+	if v, _ := a.Get("Jack"); v.String() != "600" {
+		t.Fatalf("Jack 应该是新值，got %q", v)
+	}
+
+	if err := b.Remove("Jack"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.mainCache.get("Jack"); ok {
+		t.Fatalf("Remove 应该删除所属节点 a 上的缓存")
+	}
+
+	a.Get("Jack")
+	if err := b.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.mainCache.get("Jack"); ok {
+		t.Fatalf("Purge 应该清空所有节点")
+	}
+	if _, ok := b.mainCache.get("Tom"); ok {
+		t.Fatalf("Purge 应该清空本节点")
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key + "-value"), nil
+	})
+	owner := NewGroup("hot-owner", 2<<10, getter)
+	peer := &fakePeer{g: owner}
+	//每次远程获取都放入 hotCache，两个缓存共用的内存刚好放得下 3 条本地数据
+	localBytes := lru.EntrySize("local-1", ByteView{b: []byte("local-1-value")})
+	cacheBytes := 3*localBytes + 16
+	g := NewGroup("hot", cacheBytes, getter, WithHotCache(2*localBytes, 1))
+	g.RegisterPeers(&fakePicker{owners: map[string]PeerGetter{"hot": peer, "warm": peer}, others: []PeerGetter{peer}})
+
+	for i := 0; i < 3; i++ {
+		if v, err := g.Get("hot"); err != nil || v.String() != "hot-value" {
+			t.Fatalf("Get(hot) = %q, %v", v, err)
+		}
+	}
+	if peer.gets != 1 {
+		t.Fatalf("热点 key 应该只从所属节点获取一次，got %d", peer.gets)
+	}
+	if _, ok := g.mainCache.get("hot"); ok {
+		t.Fatalf("远程获取的值不应该放入 mainCache")
+	}
+
+	//本地数据写满 mainCache 时，hotCache 超过 mainCache 的 1/8，优先淘汰 hotCache
+	for _, key := range []string{"local-1", "local-2", "local-3"} {
+		g.Get(key)
+	}
+	if g.mainCache.bytes()+g.hotCache.bytes() > cacheBytes {
+		t.Fatalf("两个缓存合计不应超过 cacheBytes，got %d + %d", g.mainCache.bytes(), g.hotCache.bytes())
+	}
+	if _, ok := g.hotCache.get("hot"); ok {
+		t.Fatalf("hot 应该已经从 hotCache 中淘汰")
+	}
+
+	//删除通知同样会删除 hotCache 中的副本
+	g.Get("warm")
+	g.removeLocally("warm")
+	if _, ok := g.hotCache.get("warm"); ok {
+		t.Fatalf("removeLocally 应该删除 hotCache 中的副本")
+	}
+}
+
+// hotCache 总是有上限，cacheBytes 很小时也能放下几条记录
+func TestHotCacheDefaultBudget(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	if g := NewGroup("hot-unlimited", 0, getter); g.hotCache.cacheBytes != defaultHotCacheBytes {
+		t.Fatalf("cacheBytes 为 0 时 hotCache 也应该有上限，got %d", g.hotCache.cacheBytes)
+	}
+	entry := lru.EntrySize("key1", ByteView{b: []byte("value1")})
+	small := NewGroup("hot-small", 2<<10, getter)
+	if n := small.hotCache.cacheBytes / entry; n < 4 || small.hotCache.cacheBytes > small.cacheBytes/2 {
+		t.Fatalf("2KB 的 Group 中 hotCache 应该放得下几条记录且不超过一半，got %d 字节", small.hotCache.cacheBytes)
+	}
+	if g := NewGroup("hot-large", 64<<20, getter); g.hotCache.cacheBytes != 8<<20 {
+		t.Fatalf("hotCache 默认占用 cacheBytes 的 1/8，got %d", g.hotCache.cacheBytes)
+	}
+
+	//cacheBytes 为 0 时远程获取的副本也不会无限增长
+	owner := NewGroup("hot-unlimited-owner", 0, getter)
+	peer := &fakePeer{g: owner}
+	g := NewGroup("hot-unlimited-peer", 0, getter, WithHotCache(8*entry, 1))
+	owners := make(map[string]PeerGetter)
+	for i := 0; i < 100; i++ {
+		owners["key"+strconv.Itoa(i)] = peer
+	}
+	g.RegisterPeers(&fakePicker{owners: owners})
+	for key := range owners {
+		g.Get(key)
+	}
+	if b := g.hotCache.bytes(); b == 0 || b > 8*entry {
+		t.Fatalf("hotCache 应该限制在 %d 字节以内，got %d", 8*entry, b)
+	}
+}
+
+func TestStats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "bad" {
+			return nil, fmt.Errorf("bad key")
+		}
+		return []byte("v"), nil
+	}))
+	g.Get("a")
+	g.Get("a")
+	g.Get("bad")
+	g.Set("b", []byte("v"))
+	g.Remove("b")
+
+	s := g.Stats()
+	if s.Gets != 3 || s.Hits != 1 || s.LocalLoads != 1 || s.LocalLoadErrs != 1 || s.LoadsDeduped != 0 {
+		t.Fatalf("unexpected group stats %+v", s)
+	}
+	if s.MainCache.Items != 1 || s.MainCache.Bytes != lru.EntrySize("a", ByteView{b: []byte("v")}) || s.MainCache.Gets != 3 || s.MainCache.Hits != 1 || s.MainCache.Evictions != 0 {
+		t.Fatalf("unexpected cache stats %+v", s.MainCache)
+	}
+
+	//放不下的值被拒绝，同时移除旧值，不计入淘汰次数
+	g.Set("a", make([]byte, 4<<10))
+	if s := g.Stats().MainCache; s.Items != 0 || s.Evictions != 0 {
+		t.Fatalf("rejected add should not count as an eviction, got %+v", s)
+	}
+}
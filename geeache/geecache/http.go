@@ -4,14 +4,24 @@ package geecache
 提供被其他节点访问的能力(基于http)
 */
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"geecache/consistenthash"
+	"geecache/discovery"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	pb "geecache/geecachepb"
 
 	"github.com/golang/protobuf/proto"
@@ -20,30 +30,62 @@ import (
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50 //虚拟节点倍数
+	//统计信息的路由，例如 /_geecache/_stats；分组的路由总是包含 key，不会与它们冲突
+	statsPath   = "_stats"   //JSON 格式，按 Group 名称输出 GroupStats
+	metricsPath = "_metrics" //Prometheus 文本格式
+	//访问远程节点的超时时间，节点地址配置错误(例如把自己当成了远程节点)时请求不会一直阻塞
+	defaultPeerTimeout = 10 * time.Second
+
+	//节点间写请求(PUT/DELETE)的签名，见 WithSecretKey
+	timestampHeader  = "X-Geecache-Timestamp" //签名时的 Unix 时间(秒)
+	signatureHeader  = "X-Geecache-Signature" //十六进制的 HMAC-SHA256
+	maxSignatureSkew = 5 * time.Minute        //签名时间与本地时间相差超过该值时拒绝，限制重放旧请求的时间窗口
 )
 
+// 访问远程节点使用的客户端
+var peerClient = &http.Client{Timeout: defaultPeerTimeout}
+
 //结构体 HTTPPool，作为承载节点间 HTTP 通信的核心数据结构(包括服务端和客户端)
 type HTTPPool struct {
 	// this peer's base URL, e.g. "https://example.net:8000"
 	self        string                 //记录自己的地址，包括主机名/IP 和端口
 	basePath    string                 //作为节点间通讯地址的前缀，默认是 /_geecache/
-	mu          sync.Mutex             // guards peers and httpGetters
-	peers       *consistenthash.Map    //类型是一致性哈希算法的 Map，用来根据具体的 key 选择节点
+	mu          sync.Mutex             //串行化节点列表的更新，PickPeer 不需要加锁
+	peers       atomic.Value           //当前节点列表的快照 *peerSet，更新时整体替换
+	onRebalance func(moved []consistenthash.Range) //节点变化后的回调，通过 WithRebalance 设置
+	logger      Logger                 //默认不输出日志，通过 WithPoolLogger 替换
+	secretKey   []byte                 //节点间写请求的共享密钥，为空时拒绝所有写请求，通过 WithSecretKey 设置
+}
+
+// 节点列表的快照，创建后不再修改
+type peerSet struct {
+	ring *consistenthash.Map //类型是一致性哈希算法的 Map，用来根据具体的 key 选择节点
 	//映射远程节点与对应的 httpGetter。每一个远程节点对应一个 httpGetter，因为 httpGetter 与远程节点的地址 baseURL 有关
 	httpGetters map[string]*httpGetter //key_eg: "http://10.0.0.2:8008"
 }
 
+// 还没有设置节点时使用的空列表
+var noPeers = &peerSet{ring: consistenthash.New(defaultReplicas, nil), httpGetters: map[string]*httpGetter{}}
+
 // NewHTTPPool initializes an HTTP pool of peers.
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		logger:   NopLogger,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // Log info with server name
+// 以 Info 级别写入 HTTPPool 的日志，附带当前服务的地址
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[当前服务:%s] %s", p.self, fmt.Sprintf(format, v...))
+	if p.logger.Enabled(LevelInfo) {
+		p.logger.Log(LevelInfo, fmt.Sprintf(format, v...), "self", p.self)
+	}
 }
 
 // 通过路由获取groupname(需要提前创建缓存组，若没有在groups中找到会报错)和
@@ -54,7 +96,18 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
-	p.Log("响应方法:%s 路由:%s", r.Method, r.URL.Path)
+	if p.logger.Enabled(LevelDebug) {
+		p.logger.Log(LevelDebug, "响应请求", "self", p.self, "method", r.Method, "path", r.URL.Path)
+	}
+	switch r.URL.Path[len(p.basePath):] {
+	case statsPath:
+		p.serveStats(w)
+		return
+	case metricsPath:
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w)
+		return
+	}
 	// 将/<basepath>/<groupname>/<key>拆分为["<groupname>","<key>"]
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -70,11 +123,48 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
+	group.stats.serverRequests.Add(1)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut: //其他节点调用 Group.Set，本节点是 key 的所属节点
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !p.verify(w, r, body) {
+			return
+		}
+		req := &pb.Request{}
+		if err = proto.Unmarshal(body, req); err != nil {
+			http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		group.setLocally(key, req.GetValue())
+		w.Header().Set("Content-Type", "application/octet-stream")
+		return
+	case http.MethodDelete: //其他节点调用 Group.Remove 或 Group.Purge，只处理本地缓存，不再转发
+		if !p.verify(w, r, nil) {
+			return
+		}
+		if key == "" {
+			group.purgeLocally()
+		} else {
+			group.removeLocally(key)
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		return
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
 	view, err := group.Get(key) //获取组中key对应的缓存
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		fmt.Println("获取缓存值失败")
+		p.logger.Log(LevelWarn, "获取缓存值失败", "self", p.self, "group", groupName, "key", key, "err", err)
 		return
 	}
 
@@ -90,43 +180,227 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
-//注册传入的peers节点，并为每一个节点创建节点间通讯地址
+// 校验写请求的签名，失败时响应 403 并返回 false。没有配置密钥时不允许任何写请求
+func (p *HTTPPool) verify(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if len(p.secretKey) == 0 {
+		http.Error(w, "writes are disabled on this peer", http.StatusForbidden)
+		return false
+	}
+	ts := r.Header.Get(timestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(sec, 0)) > maxSignatureSkew || time.Until(time.Unix(sec, 0)) > maxSignatureSkew {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return false
+	}
+	want := signRequest(p.secretKey, r.Method, r.URL.EscapedPath(), ts, body)
+	if !hmac.Equal([]byte(r.Header.Get(signatureHeader)), []byte(want)) {
+		p.logger.Log(LevelWarn, "写请求签名错误", "self", p.self, "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// 写请求的签名：HMAC-SHA256(key, 方法\n转义后的路径\n时间戳\n请求体)
+func signRequest(key []byte, method, path, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(method + "\n" + path + "\n" + ts + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 以 JSON 格式输出所有 Group 的统计信息
+func (p *HTTPPool) serveStats(w http.ResponseWriter) {
+	stats := make(map[string]GroupStats)
+	for _, g := range allGroups() {
+		stats[g.name] = g.Stats()
+	}
+	body, err := json.Marshal(stats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+//注册传入的peers节点，并为每一个节点创建节点间通讯地址，替换原有的全部节点
 func (p *HTTPPool) Set(peers ...string) {
+	p.update(func(next *peerSet) {
+		next.ring = consistenthash.New(defaultReplicas, nil) // 实例化一致性哈希算法
+		next.ring.Add(peers...) //添加了传入的节点
+		getters := make(map[string]*httpGetter, len(peers))
+		for _, peer := range peers { //为每一个节点创建了一个 HTTP 客户端 httpGetter，已有的节点继续使用原来的
+			if getter, ok := next.httpGetters[peer]; ok {
+				getters[peer] = getter
+			} else {
+				getters[peer] = p.newGetter(peer)
+			}
+		}
+		next.httpGetters = getters
+	})
+}
+
+// AddPeer 向环上添加节点，已经存在的节点会被忽略。只有新节点附近的 key 会迁移，不需要重建整个环
+func (p *HTTPPool) AddPeer(peers ...string) {
+	p.update(func(next *peerSet) {
+		for _, peer := range peers {
+			if _, ok := next.httpGetters[peer]; ok {
+				continue
+			}
+			next.ring.Add(peer)
+			next.httpGetters[peer] = p.newGetter(peer)
+		}
+	})
+}
+
+// RemovePeer 从环上删除节点，它负责的 key 迁移到环上的下一个节点
+func (p *HTTPPool) RemovePeer(peers ...string) {
+	p.update(func(next *peerSet) {
+		for _, peer := range peers {
+			if _, ok := next.httpGetters[peer]; !ok {
+				continue
+			}
+			next.ring.Remove(peer)
+			delete(next.httpGetters, peer)
+		}
+	})
+}
+
+// Watch 使用 d 发现的节点列表持续更新 HTTPPool，直到 ctx 取消或 d 返回错误。
+// 每次只增删变化的节点，列表中应该包括自己，否则属于自己的 key 会交给其他节点
+func (p *HTTPPool) Watch(ctx context.Context, d discovery.Discovery) error {
+	return d.Watch(ctx, p.sync)
+}
+
+// 把节点列表同步为 peers：添加新出现的节点，删除不再出现的节点，在同一次更新中完成
+func (p *HTTPPool) sync(peers []string) {
+	p.update(func(next *peerSet) {
+		keep := make(map[string]bool, len(peers))
+		for _, peer := range peers {
+			keep[peer] = true
+			if _, ok := next.httpGetters[peer]; !ok {
+				next.ring.Add(peer)
+				next.httpGetters[peer] = p.newGetter(peer)
+			}
+		}
+		for peer := range next.httpGetters {
+			if !keep[peer] {
+				next.ring.Remove(peer)
+				delete(next.httpGetters, peer)
+			}
+		}
+	})
+}
+
+// Peers 返回当前的全部节点(包括自己)，按地址排序
+func (p *HTTPPool) Peers() []string {
+	set := p.loadPeers()
+	peers := make([]string, 0, len(set.httpGetters))
+	for peer := range set.httpGetters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// 在当前节点列表的拷贝上执行 change，再原子地替换快照(写时复制)，正在执行的 PickPeer 仍然使用旧的快照。
+// 替换后计算归属发生变化的区间并调用 onRebalance
+func (p *HTTPPool) update(change func(next *peerSet)) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil) // 实例化一致性哈希算法
-	p.peers.Add(peers...) //添加了传入的节点
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers { //为每一个节点创建了一个 HTTP 客户端 httpGetter
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
-		fmt.Printf("HTTPPool.httpGetters中 节点:%v--通讯地址:%v\n",peer,peer + p.basePath)
+	old := p.loadPeers()
+	next := &peerSet{ring: old.ring.Clone(), httpGetters: make(map[string]*httpGetter, len(old.httpGetters))}
+	for peer, getter := range old.httpGetters {
+		next.httpGetters[peer] = getter
+	}
+	change(next)
+	p.peers.Store(next)
+
+	moved := next.ring.Moved(old.ring)
+	p.logger.Log(LevelInfo, "更新节点列表", "self", p.self, "peers", len(next.httpGetters), "movedRanges", len(moved))
+	if len(moved) > 0 && p.onRebalance != nil {
+		p.onRebalance(moved)
 	}
+}
+
+func (p *HTTPPool) loadPeers() *peerSet {
+	if set, ok := p.peers.Load().(*peerSet); ok {
+		return set
+	}
+	return noPeers
+}
 
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	return &httpGetter{baseURL: peer + p.basePath, logger: p.logger, secretKey: p.secretKey}
 }
 
 // 根据具体的 key，得到应该存放的真实节点，返回真实节点对应的 httpGetter (HTTP 客户端)
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("真实节点%s", peer)
-		fmt.Printf("%v存放在真实节点%v上",key,peer)
-		return p.httpGetters[peer], true
+	set := p.loadPeers()
+	if peer := set.ring.Get(key); peer != "" && peer != p.self {
+		if p.logger.Enabled(LevelDebug) {
+			p.logger.Log(LevelDebug, "选择远程节点", "self", p.self, "key", key, "peer", peer)
+		}
+		return set.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// 返回除自己以外的所有节点对应的 httpGetter
+func (p *HTTPPool) GetAll() []PeerGetter {
+	set := p.loadPeers()
+	all := make([]PeerGetter, 0, len(set.httpGetters))
+	for peer, getter := range set.httpGetters {
+		if peer != p.self {
+			all = append(all, getter)
+		}
+	}
+	return all
+}
+
 var _ PeerPicker = (*HTTPPool)(nil)
+var _ PeerLister = (*HTTPPool)(nil)
 
 //HTTP 客户端类
 type httpGetter struct {
-	baseURL string //将要访问的远程节点的地址，例如 http://example.com/_geecache/
+	baseURL   string //将要访问的远程节点的地址，例如 http://example.com/_geecache/
+	logger    Logger
+	secretKey []byte //签名 PUT/DELETE 请求的共享密钥
+}
+
+// 在日志中以地址表示节点
+func (h *httpGetter) String() string {
+	return h.baseURL
 }
 
 //返回客户端响应中body(即group中key对应的缓存值)
 //使用 http.Get() 方式获取返回值，并转换为 []bytes 类型
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 //func (h *httpGetter) Get(group string, key string) ([]byte, error) {
+	return h.do(http.MethodGet, in, out, nil)
+}
+
+// 使用 PUT 把缓存值写入远程节点，请求体是 protobuf 编码的 Request
+func (h *httpGetter) Set(in *pb.Request, out *pb.Response) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request body: %v", err)
+	}
+	return h.do(http.MethodPut, in, out, body)
+}
+
+// 使用 DELETE 删除远程节点本地的缓存
+func (h *httpGetter) Remove(in *pb.Request, out *pb.Response) error {
+	return h.do(http.MethodDelete, in, out, nil)
+}
+
+// 使用 DELETE 并且 key 为空，清空远程节点本地整个 group 的缓存
+func (h *httpGetter) Purge(in *pb.Request, out *pb.Response) error {
+	return h.do(http.MethodDelete, &pb.Request{Group: in.GetGroup()}, out, nil)
+}
+
+func (h *httpGetter) do(method string, in *pb.Request, out *pb.Response, body []byte) error {
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
@@ -135,8 +409,19 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 		url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()),
 	)
-	fmt.Printf("客户端Get方法中url:%v\n",u)
-	res, err := http.Get(u) //这里直接到了ServeHTTP,这个流程中又走了一遍(g *Group) load(key string) (value ByteView, err error)
+	if h.logger != nil && h.logger.Enabled(LevelDebug) {
+		h.logger.Log(LevelDebug, "访问远程节点", "method", method, "url", u)
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if method != http.MethodGet && len(h.secretKey) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(timestampHeader, ts)
+		req.Header.Set(signatureHeader, signRequest(h.secretKey, method, req.URL.EscapedPath(), ts, body))
+	}
+	res, err := peerClient.Do(req) //这里直接到了ServeHTTP,这个流程中又走了一遍(g *Group) load(key string) (value ByteView, err error)
 	if err != nil {
 		return err
 	}
@@ -146,13 +431,13 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 		return fmt.Errorf("server returned: %v", res.Status)
 	}
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return fmt.Errorf("reading response body: %v", err)
 	}
 
 	//使用 proto.Unmarshal() 解码 HTTP 响应,传入out中,作为(g *Group) getFromPeer方法中的res.Value
-	if err = proto.Unmarshal(bytes, out); err != nil {
+	if err = proto.Unmarshal(data, out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
 
@@ -0,0 +1,311 @@
+package geecache
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"geecache/consistenthash"
+	"geecache/discovery"
+	pb "geecache/geecachepb"
+)
+
+func TestHTTPPoolSetRemove(t *testing.T) {
+	g := NewGroup("http-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("from-source"), nil
+	}))
+	key := []byte("secret")
+	pool := NewHTTPPool("", WithSecretKey(key))
+	server := httptest.NewServer(pool)
+	defer server.Close()
+	peer := &httpGetter{baseURL: server.URL + defaultBasePath, secretKey: key}
+
+	if err := peer.Set(&pb.Request{Group: g.name, Key: "Tom", Value: []byte("630")}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	out := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: g.name, Key: "Tom"}, out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("Get after Set = %q, %v", out.Value, err)
+	}
+	if err := peer.Remove(&pb.Request{Group: g.name, Key: "Tom"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("Remove should delete the cached value")
+	}
+
+	g.Get("Jack")
+	if err := peer.Purge(&pb.Request{Group: g.name}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("Jack"); ok {
+		t.Fatalf("Purge should clear the group")
+	}
+}
+
+// 没有配置密钥、密钥不同或签名过期的写请求都被拒绝，GET 不受影响
+func TestHTTPPoolWriteAuth(t *testing.T) {
+	g := NewGroup("http-auth", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("from-source"), nil
+	}))
+	set := &pb.Request{Group: g.name, Key: "Tom", Value: []byte("evil")}
+
+	open := httptest.NewServer(NewHTTPPool(""))
+	defer open.Close()
+	for _, peer := range []*httpGetter{
+		{baseURL: open.URL + defaultBasePath},
+		{baseURL: open.URL + defaultBasePath, secretKey: []byte("secret")},
+	} {
+		if err := peer.Set(set, &pb.Response{}); err == nil || !strings.Contains(err.Error(), "403") {
+			t.Fatalf("writes should be disabled without a secret key, got %v", err)
+		}
+		if err := peer.Purge(&pb.Request{Group: g.name}, &pb.Response{}); err == nil {
+			t.Fatalf("purge should be disabled without a secret key")
+		}
+	}
+
+	server := httptest.NewServer(NewHTTPPool("", WithSecretKey([]byte("secret"))))
+	defer server.Close()
+	for _, peer := range []*httpGetter{
+		{baseURL: server.URL + defaultBasePath},
+		{baseURL: server.URL + defaultBasePath, secretKey: []byte("wrong")},
+	} {
+		if err := peer.Set(set, &pb.Response{}); err == nil || !strings.Contains(err.Error(), "403") {
+			t.Fatalf("unsigned or wrongly signed write should be rejected, got %v", err)
+		}
+	}
+
+	//正确的签名但时间戳过期，不能重放
+	u := server.URL + defaultBasePath + g.name + "/Tom"
+	ts := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	req, _ := http.NewRequest(http.MethodDelete, u, nil)
+	req.Header.Set(timestampHeader, ts)
+	req.Header.Set(signatureHeader, signRequest([]byte("secret"), http.MethodDelete, req.URL.EscapedPath(), ts, nil))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expired signature should be rejected, got %d", res.StatusCode)
+	}
+
+	out := &pb.Response{}
+	if err := (&httpGetter{baseURL: open.URL + defaultBasePath}).Get(&pb.Request{Group: g.name, Key: "Tom"}, out); err != nil || string(out.Value) != "from-source" {
+		t.Fatalf("GET should not need a signature, got %q, %v", out.Value, err)
+	}
+}
+
+func TestHTTPPoolStats(t *testing.T) {
+	g := NewGroup("http-stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	pool := NewHTTPPool("")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+	peer := &httpGetter{baseURL: server.URL + defaultBasePath}
+	peer.Get(&pb.Request{Group: g.name, Key: "Tom"}, &pb.Response{})
+
+	res, err := http.Get(server.URL + defaultBasePath + statsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var stats map[string]GroupStats
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if s := stats[g.name]; s.ServerRequests != 1 || s.Gets != 1 || s.MainCache.Items != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	res, err = http.Get(server.URL + defaultBasePath + metricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	for _, line := range []string{
+		"# TYPE geecache_gets_total counter",
+		`geecache_server_requests_total{group="http-stats"} 1`,
+		`geecache_cache_items{group="http-stats",cache="main"} 1`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("metrics should contain %q", line)
+		}
+	}
+}
+
+func TestHTTPPoolMembership(t *testing.T) {
+	var moved []consistenthash.Range
+	pool := NewHTTPPool("http://a", WithRebalance(func(m []consistenthash.Range) { moved = m }))
+	if _, ok := pool.PickPeer("Tom"); ok {
+		t.Fatalf("没有节点时不应该选择远程节点")
+	}
+
+	pool.Set("http://a", "http://b")
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = owner(pool, key)
+	}
+
+	moved = nil
+	pool.AddPeer("http://c", "http://b")
+	if !reflect.DeepEqual(pool.Peers(), []string{"http://a", "http://b", "http://c"}) {
+		t.Fatalf("Peers() = %v", pool.Peers())
+	}
+	if len(moved) == 0 {
+		t.Fatalf("添加节点后应该报告迁移的区间")
+	}
+	for key, old := range before {
+		now := owner(pool, key)
+		inMoved := false
+		for _, r := range moved {
+			if r.Contains(crc32.ChecksumIEEE([]byte(key))) {
+				inMoved = true
+				if r.From != old || r.To != now || now != "http://c" {
+					t.Fatalf("%s 从 %s 迁移到 %s，区间记录为 %+v", key, old, now, r)
+				}
+			}
+		}
+		if !inMoved && now != old {
+			t.Fatalf("%s 不在迁移的区间中，归属却从 %s 变为 %s", key, old, now)
+		}
+	}
+
+	moved = nil
+	pool.RemovePeer("http://c", "http://unknown")
+	for key, old := range before {
+		if now := owner(pool, key); now != old {
+			t.Fatalf("删除 c 之后 %s 应该回到 %s，got %s", key, old, now)
+		}
+	}
+	if len(moved) == 0 || moved[0].From != "http://c" {
+		t.Fatalf("moved = %v", moved)
+	}
+	if len(pool.GetAll()) != 1 {
+		t.Fatalf("GetAll 应该只返回 b")
+	}
+}
+
+// PickPeer 读取快照，不会因为并发的更新而阻塞或读到不一致的状态
+func TestHTTPPoolConcurrentPick(t *testing.T) {
+	pool := NewHTTPPool("http://a")
+	pool.Set("http://a", "http://b")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			pool.AddPeer("http://c")
+			pool.RemovePeer("http://c")
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if peer, ok := pool.PickPeer("Tom"); ok && peer == nil {
+			t.Fatalf("选中的节点没有对应的 httpGetter")
+		}
+	}
+}
+
+// key 所属的节点地址，属于自己时返回 self
+func owner(p *HTTPPool, key string) string {
+	if peer, ok := p.PickPeer(key); ok {
+		return strings.TrimSuffix(peer.(*httpGetter).baseURL, defaultBasePath)
+	}
+	return p.self
+}
+
+// 由测试手动推送节点列表的 Discovery
+type fakeDiscovery chan []string
+
+func (d fakeDiscovery) Watch(ctx context.Context, update func(peers []string)) error {
+	for {
+		select {
+		case peers := <-d:
+			update(peers)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestHTTPPoolWatch(t *testing.T) {
+	pool := NewHTTPPool("http://a")
+	pool.Set("http://a", "http://b")
+	getter := pool.loadPeers().httpGetters["http://b"]
+
+	d := make(fakeDiscovery)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- pool.Watch(ctx, d) }()
+	d <- []string{"http://a", "http://b", "http://c"}
+	d <- []string{"http://b", "http://a"}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("ctx 取消后 Watch 应该返回 context.Canceled，got %v", err)
+	}
+	if !reflect.DeepEqual(pool.Peers(), []string{"http://a", "http://b"}) {
+		t.Fatalf("Peers() = %v", pool.Peers())
+	}
+	if pool.loadPeers().httpGetters["http://b"] != getter {
+		t.Fatalf("没有变化的节点应该继续使用原来的 httpGetter")
+	}
+}
+
+// 每个节点通过 gossip 发现彼此，HTTPPool 最终得到相同的节点列表；节点退出后从列表中删除
+func TestHTTPPoolWatchGossip(t *testing.T) {
+	var nodes []*discovery.Gossip
+	var pools []*HTTPPool
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 1; i <= 3; i++ {
+		config := discovery.GossipConfig{
+			BindAddr:         "127.0.0.1:0",
+			Meta:             "http://node" + strconv.Itoa(i),
+			ProbeInterval:    20 * time.Millisecond,
+			ProbeTimeout:     10 * time.Millisecond,
+			SuspicionTimeout: 100 * time.Millisecond,
+		}
+		if len(nodes) > 0 {
+			config.Seeds = []string{nodes[0].Addr()}
+		}
+		node, err := discovery.NewGossip(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer node.Close()
+		pool := NewHTTPPool(config.Meta)
+		go pool.Watch(ctx, node)
+		nodes, pools = append(nodes, node), append(pools, pool)
+	}
+
+	waitPeers := func(pools []*HTTPPool, want []string) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for _, pool := range pools {
+			for !reflect.DeepEqual(pool.Peers(), want) {
+				if time.Now().After(deadline) {
+					t.Fatalf("%s: Peers() = %v, want %v", pool.self, pool.Peers(), want)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		}
+	}
+	waitPeers(pools, []string{"http://node1", "http://node2", "http://node3"})
+	nodes[2].Close()
+	waitPeers(pools[:2], []string{"http://node1", "http://node2"})
+}
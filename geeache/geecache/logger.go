@@ -0,0 +1,91 @@
+package geecache
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level 是日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Logger 是可替换的分级日志接口。keyvals 是交替出现的键和值，例如 "key", "Tom", "peer", addr。
+// 调用方在热点路径上会先用 Enabled 判断，避免为不输出的日志准备参数
+type Logger interface {
+	Enabled(level Level) bool
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// 默认不输出任何日志
+type nopLogger struct{}
+
+func (nopLogger) Enabled(Level) bool                { return false }
+func (nopLogger) Log(Level, string, ...interface{}) {}
+
+// NopLogger 丢弃所有日志，是 Group 和 HTTPPool 的默认值
+var NopLogger Logger = nopLogger{}
+
+// StdLogger 把日志以 key=value 的形式写入标准库的 log.Logger
+type StdLogger struct {
+	Logger   *log.Logger // 为 nil 时使用 log 包的默认 Logger
+	MinLevel Level       // 低于该级别的日志不输出
+}
+
+// NewStdLogger 创建输出到 log 包默认 Logger 的 StdLogger
+func NewStdLogger(minLevel Level) *StdLogger {
+	return &StdLogger{MinLevel: minLevel}
+}
+
+func (l *StdLogger) Enabled(level Level) bool {
+	return level >= l.MinLevel
+}
+
+func (l *StdLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("[geecache] ")
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		b.WriteByte(' ')
+		if i+1 < len(keyvals) {
+			fmt.Fprintf(&b, "%v=%v", keyvals[i], keyvals[i+1])
+		} else {
+			fmt.Fprintf(&b, "!BADKEY=%v", keyvals[i]) // 与 slog 一致，落单的值使用 !BADKEY 作为键
+		}
+	}
+	if l.Logger != nil {
+		l.Logger.Output(2, b.String())
+	} else {
+		log.Output(2, b.String())
+	}
+}
+
+var (
+	_ Logger = nopLogger{}
+	_ Logger = (*StdLogger)(nil)
+)
@@ -0,0 +1,87 @@
+package geecache
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type logRecord struct {
+	level   Level
+	msg     string
+	keyvals []interface{}
+}
+
+// 记录所有日志，用于断言
+type recordLogger struct {
+	mu      sync.Mutex
+	min     Level
+	records []logRecord
+}
+
+func (l *recordLogger) Enabled(level Level) bool { return level >= l.min }
+
+func (l *recordLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, logRecord{level, msg, keyvals})
+}
+
+func (l *recordLogger) count(level Level) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, r := range l.records {
+		if r.level == level {
+			n++
+		}
+	}
+	return n
+}
+
+func TestGroupLogger(t *testing.T) {
+	owner := NewGroup("log-owner", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("owner is down")
+	}))
+	logger := &recordLogger{min: LevelDebug}
+	g := NewGroup("log-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}), WithLogger(logger))
+	g.RegisterPeers(&fakePicker{owners: map[string]PeerGetter{"Tom": &fakePeer{g: owner}}})
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Get(Tom) = %q, %v", v.String(), err)
+	}
+	g.Get("Tom")
+	if n := logger.count(LevelWarn); n != 1 {
+		t.Fatalf("peer failure should log one warning, got %d", n)
+	}
+	if n := logger.count(LevelDebug); n != 2 {
+		t.Fatalf("local load and cache hit should log at debug level, got %d records", n)
+	}
+
+	quiet := &recordLogger{min: LevelInfo}
+	g2 := NewGroup("log-quiet", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}), WithLogger(quiet))
+	g2.Get("Tom")
+	g2.Get("Tom")
+	if len(quiet.records) != 0 {
+		t.Fatalf("debug records should be skipped when disabled, got %v", quiet.records)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := &StdLogger{Logger: log.New(&buf, "", 0), MinLevel: LevelInfo}
+	l.Log(LevelDebug, "hidden")
+	l.Log(LevelWarn, "peer failed", "peer", "http://localhost:8001", "err", "timeout", "odd")
+	got := strings.TrimSpace(buf.String())
+	want := "[geecache] WARN peer failed peer=http://localhost:8001 err=timeout !BADKEY=odd"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -2,62 +2,119 @@ package lru
 /**
 lru 缓存淘汰策略
 */
-import "container/list"
+import (
+	"container/list"
+	"time"
+	"unsafe"
+)
+
+// mapEntryOverhead 是 map[string]*list.Element 中一项的摊销开销：key 的字符串头 16 字节、指针 8 字节、
+// tophash 1 字节，按平均 80% 的装载率再加上溢出桶，约 40 字节
+const mapEntryOverhead = 40
+
+// EntryOverhead 是每条记录除了 key 和值的内容以外占用的内存：链表节点 list.Element、entry 结构体和 map 中的一项。
+// 值很小时这部分开销远大于数据本身，只统计 len(key)+value.Len() 会让实际内存达到 maxBytes 的数倍
+const EntryOverhead = int64(unsafe.Sizeof(list.Element{})+unsafe.Sizeof(entry{})) + mapEntryOverhead
 
 // Cache是一个LRU缓存。它对于并发访问不安全。
 type Cache struct {
 	maxBytes int64 //允许使用的最大内存
-	nbytes   int64 //当前已使用的内存
+	nbytes   int64 //当前已使用的内存，每条记录按 EntrySize 计算
+	MaxEntries int //允许保存的最大记录数，0 表示不限制
 	ll       *list.List //双向链表(存放entry结构体)
 	cache    map[string]*list.Element //值是双向链表中对应节点的指针
 	OnEvicted func(key string, value Value) //某条记录被移除时的回调函数，可以为 nil
+	Now       func() time.Time              //判断过期使用的时钟，测试时可以替换，默认 time.Now
 }
 
 type entry struct {
 	//双向链表节点的数据类型，在链表中仍保存每个值对应的 key 的好处在于，
 	//淘汰队首节点时，需要用 key 从字典中删除对应的映射
-	key   string
-	value Value //缓存值
+	key    string
+	value  Value     //缓存值
+	expire time.Time //过期时间，零值表示永不过期
+	size   int64     //加入时按 EntrySize 计算的大小，移除时原样扣除
 }
 
 type Value interface {
 	Len() int //用于返回值所占用的内存大小
 }
 
+// Sizer 可以由 Value 实现，返回值实际占用的全部内存，包括值本身的头部和引用的底层数组；
+// 实现了 Sizer 的值使用 Size 代替 Len 计算内存
+type Sizer interface {
+	Size() int64
+}
+
+// EntrySize 返回一条记录计入 maxBytes 的大小：key 的内容、值的大小和 EntryOverhead
+func EntrySize(key string, value Value) int64 {
+	size := int64(len(key)) + EntryOverhead
+	if s, ok := value.(Sizer); ok {
+		return size + s.Size()
+	}
+	return size + int64(value.Len())
+}
+
 func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 	return &Cache{
 		maxBytes:  maxBytes, //若传入int64(0)，则这里假定可以无限添加
 		ll:        list.New(),
 		cache:     make(map[string]*list.Element),
 		OnEvicted: onEvicted,
+		Now:       time.Now,
 	}
 }
 
-// Add向缓存中添加一个值
+// Add向缓存中添加一个永不过期的值
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 向缓存中添加一个值，到达 expire 之后视为不存在，expire 为零值时永不过期。
+// 比 maxBytes 还大的值不会被加入(否则会淘汰掉所有的记录后仍然放不下)，同一个 key 的旧值也会被移除
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	size := EntrySize(key, value)
+	if c.maxBytes != 0 && size > c.maxBytes {
+		c.Remove(key)
+		return
+	}
 	//ele是链表节点的指针，*ele就是节点
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele) //将该节点移到队尾
 		kv := ele.Value.(*entry)
-		c.nbytes += int64(value.Len()) - int64(kv.value.Len()) //新值减去老值的长度
+		c.nbytes += size - kv.size //新值减去老值的大小
 		kv.value = value //如果键存在，则更新原节点的值
+		kv.expire = expire
+		kv.size = size
 	} else {
-		//队尾添加新节点 &entry{key, value}, 并字典中添加 key 和节点的映射关系
-		ele := c.ll.PushFront(&entry{key, value})
+		//队尾添加新节点 &entry{key, value, expire, size}, 并字典中添加 key 和节点的映射关系
+		ele := c.ll.PushFront(&entry{key, value, expire, size})
 		c.cache[key] = ele
-		c.nbytes += int64(len(key)) + int64(value.Len())
+		c.nbytes += size
 	}
-	//更新 c.nbytes，如果超过了设定的最大值 c.maxBytes，则移除最少访问的节点
-	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+	//更新 c.nbytes，如果超过了设定的最大值 c.maxBytes 或记录数超过 MaxEntries，则移除最少访问的节点
+	for (c.maxBytes != 0 && c.maxBytes < c.nbytes) || (c.MaxEntries > 0 && c.ll.Len() > c.MaxEntries) {
 		// 使用for，因为当添加一条大的键值对时，c.nbytes可能会变得很大，
 		//可能需要淘汰掉多个键值对，直到 c.maxBytes < c.nbytes
 		c.RemoveOldest()
 	}
 }
 
+// SetMaxEntries 设置 MaxEntries，实现 policy.EntryLimiter
+func (c *Cache) SetMaxEntries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	c.MaxEntries = n
+}
+
 // Get查找一个键的值
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
+		if c.expired(ele.Value.(*entry)) { //惰性删除：访问到过期的节点时顺便移除
+			c.removeElement(ele)
+			return nil, false
+		}
 		//如果键对应的链表节点存在，则将对应节点移动到队尾，并返回查找到的值
 		//将链表中的节点 ele 移动到队尾（双向链表作为队列，队首队尾是相对的，在这里约定 front 为队尾）
 		c.ll.MoveToFront(ele)
@@ -70,18 +127,54 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 	return
 }
 
+// Remove 移除 key 对应的节点，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
 // 缓存淘汰。即移除最近最少访问的节点（队首）
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back() //取到队首节点，从链表中删除
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key) //从字典中 c.cache 删除该节点的映射关系
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len()) //更新当前所用的内存
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		c.removeElement(ele)
+	}
+}
+
+// RemoveExpired 移除所有已过期的节点，返回移除的个数，供后台定期清理调用
+func (c *Cache) RemoveExpired() int {
+	removed := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev() //移除前先记下下一个要检查的节点
+		if c.expired(ele.Value.(*entry)) {
+			c.removeElement(ele)
+			removed++
 		}
+		ele = prev
 	}
+	return removed
+}
+
+func (c *Cache) expired(kv *entry) bool {
+	return !kv.expire.IsZero() && !c.Now().Before(kv.expire)
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key) //从字典中 c.cache 删除该节点的映射关系
+	c.nbytes -= kv.size //更新当前所用的内存
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Bytes 返回当前已使用的内存，包括每条记录的 EntryOverhead
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
 }
 
 func (c *Cache) Len() int {
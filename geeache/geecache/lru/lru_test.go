@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -27,7 +28,7 @@ func TestGet(t *testing.T) {
 func TestRemoveoldest(t *testing.T) {
 	k1, k2, k3 := "key1", "key2", "k3"
 	v1, v2, v3 := "value1", "value2", "v3"
-	cap := len(k1 + k2 + v1 + v2) //超过最大缓存会弹出之前的值
+	cap := len(k1+k2+v1+v2) + 2*int(EntryOverhead) //超过最大缓存会弹出之前的值
 	lru := New(int64(cap), nil)
 	lru.Add(k1, String(v1))
 	fmt.Println(lru)
@@ -45,7 +46,7 @@ func TestOnEvicted(t *testing.T) {
 	callback := func(key string, value Value) {
 		keys = append(keys, key)
 	}
-	lru := New(int64(10), callback)
+	lru := New(10+2*EntryOverhead, callback)
 	lru.Add("key1", String("123456"))
 	lru.Add("k2", String("k2"))
 	lru.Add("k3", String("k3"))
@@ -63,7 +64,79 @@ func TestAdd(t *testing.T) {
 	lru := New(int64(0), nil)
 	lru.Add("key", String("1"))
 	lru.Add("key", String("111"))
-	if lru.nbytes != int64(len("key")+len("111")) {
-		t.Fatal("expected 6 but got", lru.nbytes)
+	if lru.nbytes != int64(len("key")+len("111"))+EntryOverhead {
+		t.Fatal("expected", 6+EntryOverhead, "but got", lru.nbytes)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Unix(1000, 0)
+	evicted := make([]string, 0)
+	lru := New(int64(0), func(key string, value Value) { evicted = append(evicted, key) })
+	lru.Now = func() time.Time { return now }
+	lru.AddWithExpire("short", String("1"), now.Add(time.Second))
+	lru.AddWithExpire("long", String("2"), now.Add(time.Minute))
+	lru.Add("forever", String("3"))
+
+	now = now.Add(2 * time.Second)
+	if _, ok := lru.Get("short"); ok {
+		t.Fatalf("过期的 short 不应该命中")
+	}
+	if _, ok := lru.Get("long"); !ok || lru.Len() != 2 {
+		t.Fatalf("long 还没有过期")
+	}
+
+	now = now.Add(time.Hour)
+	if n := lru.RemoveExpired(); n != 1 || lru.Len() != 1 || lru.nbytes != int64(len("forever")+1)+EntryOverhead {
+		t.Fatalf("RemoveExpired 应该只移除 long，移除了 %d 个，剩余 %d 个", n, lru.Len())
+	}
+	if !reflect.DeepEqual(evicted, []string{"short", "long"}) {
+		t.Fatalf("过期移除也应该调用 OnEvicted，got %v", evicted)
+	}
+}
+
+type sized struct {
+	String
+	size int64
+}
+
+func (s sized) Size() int64 { return s.size }
+
+func TestSizer(t *testing.T) {
+	lru := New(0, nil)
+	lru.Add("key", sized{String("1"), 100})
+	if lru.Bytes() != int64(len("key"))+100+EntryOverhead {
+		t.Fatalf("实现了 Sizer 的值应该使用 Size 计算内存，got %d", lru.Bytes())
+	}
+	lru.Add("key", String("1"))
+	if lru.Bytes() != int64(len("key"))+1+EntryOverhead {
+		t.Fatalf("更新后应该扣除旧值的大小，got %d", lru.Bytes())
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	lru := New(0, nil)
+	lru.MaxEntries = 2
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Get("k1")
+	lru.Add("k3", String("3"))
+	if _, ok := lru.Get("k2"); ok || lru.Len() != 2 {
+		t.Fatalf("超过 MaxEntries 时应该淘汰最近最少访问的 k2")
+	}
+}
+
+func TestRejectOversize(t *testing.T) {
+	evicted := make([]string, 0)
+	lru := New(2*(EntryOverhead+4), func(key string, value Value) { evicted = append(evicted, key) })
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("big", String(make([]byte, 3*EntryOverhead)))
+	if lru.Len() != 2 || len(evicted) != 0 {
+		t.Fatalf("比 maxBytes 还大的值应该被拒绝，而不是清空缓存，evicted %v", evicted)
+	}
+	lru.Add("k1", String(make([]byte, 3*EntryOverhead)))
+	if _, ok := lru.Get("k1"); ok || !reflect.DeepEqual(evicted, []string{"k1"}) {
+		t.Fatalf("被拒绝的新值不能让旧值继续生效")
 	}
 }
@@ -0,0 +1,137 @@
+package geecache
+
+import (
+	"geecache/consistenthash"
+	"geecache/lru"
+	"geecache/policy"
+	"time"
+)
+
+const (
+	defaultJanitorInterval = time.Minute // 后台清理过期缓存的默认间隔
+	defaultHotCacheDivisor = 8           // hotCache 默认占用 cacheBytes 的 1/8
+	defaultHotCacheRatio   = 10          // 远程获取的值默认以 1/10 的概率放入 hotCache
+	defaultHotCacheBytes   = 8 << 20     // cacheBytes 为 0(不限制)时 hotCache 默认的内存上限
+	minHotCacheEntries     = 8           // cacheBytes 的 1/8 放不下这么多条空记录时 hotCache 默认使用更多的内存，但不超过 cacheBytes 的一半
+)
+
+// hotCache 默认的内存上限：cacheBytes 的 1/8，至少放得下 minHotCacheEntries 条记录(不超过 cacheBytes 的一半)；
+// cacheBytes 为 0 时 mainCache 不限制内存，但远程获取的副本仍然限制在 defaultHotCacheBytes 以内
+func defaultHotCache(cacheBytes int64) int64 {
+	if cacheBytes <= 0 {
+		return defaultHotCacheBytes
+	}
+	bytes := cacheBytes / defaultHotCacheDivisor
+	if floor := minHotCacheEntries * lru.EntryOverhead; bytes < floor {
+		bytes = floor
+		if bytes > cacheBytes/2 {
+			bytes = cacheBytes / 2
+		}
+	}
+	return bytes
+}
+
+// GroupOption 是 NewGroup 的可选项
+type GroupOption func(*Group)
+
+// WithDefaultTTL 设置缓存的默认有效期，回调函数通过 TTLGetter 返回的有效期优先
+func WithDefaultTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.defaultTTL = ttl
+	}
+}
+
+// WithJanitorInterval 设置后台清理过期缓存的间隔，<= 0 时不启动后台清理，只在访问时惰性删除
+func WithJanitorInterval(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.janitorInterval = interval
+	}
+}
+
+// WithClock 替换判断过期使用的时钟，主要用于测试
+func WithClock(now func() time.Time) GroupOption {
+	return func(g *Group) {
+		g.now = now
+	}
+}
+
+// WithHotCache 设置 hotCache 的内存上限和放入概率(1/ratio)，bytes 或 ratio <= 0 时不使用 hotCache。
+// 默认的上限见 defaultHotCache：cacheBytes 的 1/8，cacheBytes 很小时最多占一半，cacheBytes 为 0 时是 8MB
+func WithHotCache(bytes int64, ratio int) GroupOption {
+	return func(g *Group) {
+		g.hotCache.cacheBytes = bytes
+		g.hotCacheRatio = ratio
+		if bytes <= 0 {
+			g.hotCacheRatio = 0
+		}
+	}
+}
+
+// WithPolicy 设置 mainCache 和 hotCache 的淘汰策略，默认是 policy.LRU。
+// 存在大量一次性访问(扫描)时可以使用 policy.TinyLFU、policy.ARC 或 policy.TwoQueue
+func WithPolicy(newStore policy.Factory) GroupOption {
+	return func(g *Group) {
+		g.newStore = newStore
+	}
+}
+
+// WithMaxEntries 限制 mainCache 保存的记录数，超出时按淘汰策略移除记录，n <= 0 表示不限制。
+// 与 cacheBytes 同时生效；分段时平均分给各段。自定义的淘汰策略需要实现 policy.EntryLimiter
+func WithMaxEntries(n int) GroupOption {
+	return func(g *Group) {
+		if n < 0 {
+			n = 0
+		}
+		g.maxEntries = n
+	}
+}
+
+// WithShards 把 mainCache 分为 n 段(向上取整为 2 的幂)，按 key 的哈希选择分段，每段有独立的锁，
+// cacheBytes 平均分给各段，每段放不下几条记录时自动减少段数。多核高并发时可以减少锁竞争，代价是淘汰只在段内进行，不再是全局的 LRU
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// WithLogger 设置 Group 使用的日志，默认不输出任何日志
+func WithLogger(logger Logger) GroupOption {
+	return func(g *Group) {
+		if logger == nil {
+			logger = NopLogger
+		}
+		g.logger = logger
+	}
+}
+
+// HTTPPoolOption 是 NewHTTPPool 的可选项
+type HTTPPoolOption func(*HTTPPool)
+
+// WithPoolLogger 设置 HTTPPool 及其客户端使用的日志，默认不输出任何日志
+func WithPoolLogger(logger Logger) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		if logger == nil {
+			logger = NopLogger
+		}
+		p.logger = logger
+	}
+}
+
+// WithSecretKey 设置节点间写请求(Group.Set、Remove、Purge 转发的 PUT/DELETE)使用的共享密钥，所有节点必须相同。
+// 写请求带有 HMAC-SHA256 签名和时间戳，签名错误或时间相差超过 5 分钟的请求被拒绝。
+// 没有设置时节点端口拒绝所有写请求(403)，Set、Remove 在 key 属于其他节点时返回错误。
+// 注意：GET 请求不需要签名，能访问节点端口的人都可以读取缓存并触发回调函数加载数据，节点端口不应该暴露在公网
+func WithSecretKey(key []byte) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.secretKey = key
+	}
+}
+
+// WithRebalance 设置节点变化(Set、AddPeer、RemovePeer)后的回调，moved 是归属发生变化的哈希区间，
+// 可以用来清理或预热迁移的 key(key 在环上的位置是 crc32.ChecksumIEEE([]byte(key)))。
+// 回调在更新节点的锁中同步执行，不能在回调中再修改节点
+func WithRebalance(fn func(moved []consistenthash.Range)) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.onRebalance = fn
+	}
+}
@@ -7,6 +7,13 @@ type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// PeerLister 是 PeerPicker 可选实现的接口，用于向所有节点广播删除和清空；
+// 没有实现时 Remove、Purge 只通知 key 所属的节点
+type PeerLister interface {
+	// 返回除自己以外的所有节点
+	GetAll() []PeerGetter
+}
+
 //PeerGetter 就对应于上述流程中的 httpGetter (HTTP 客户端)
 //type PeerGetter interface {
 //	//返回客户端响应中body(即group中key对应的缓存值)
@@ -16,4 +23,7 @@ type PeerPicker interface {
 //使用protobuf修改，参数使用 geecachepb.pb.go 中的数据类型
 type PeerGetter interface {
 	Get(in *pb.Request, out *pb.Response) error
+	Set(in *pb.Request, out *pb.Response) error    //写入远程节点本地的缓存
+	Remove(in *pb.Request, out *pb.Response) error //删除远程节点本地的缓存
+	Purge(in *pb.Request, out *pb.Response) error  //清空远程节点本地整个 group 的缓存
 }
\ No newline at end of file
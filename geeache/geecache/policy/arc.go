@@ -0,0 +1,157 @@
+package policy
+
+import "time"
+
+// ARC(Adaptive Replacement Cache)把只访问过一次的记录放在 t1，访问过多次的放在 t2，
+// 并用幽灵队列 b1、b2 记住最近从 t1、t2 淘汰的 key。
+// 命中 b1 说明 t1 太小，命中 b2 说明 t2 太小，据此调整 t1 的目标大小 p。
+// 这里的大小都按字节计算，幽灵记录不占用 maxBytes，但总大小也限制在 2*maxBytes 以内
+func ARC(maxBytes int64, onEvicted func(key string, value Value), now func() time.Time) Cache {
+	return &arcCache{
+		base:   newBase(maxBytes, onEvicted, now),
+		t1:     newQueue(),
+		t2:     newQueue(),
+		b1:     newQueue(),
+		b2:     newQueue(),
+		ghosts: make(map[string]*entry),
+	}
+}
+
+type arcCache struct {
+	base
+	t1, t2 queue             //最近只访问过一次 / 访问过至少两次的记录
+	b1, b2 queue             //最近从 t1 / t2 淘汰的幽灵记录
+	ghosts map[string]*entry //b1 和 b2 中的幽灵记录
+	p      int64             //t1 的目标大小
+}
+
+func (c *arcCache) AddWithExpire(key string, value Value, expire time.Time) {
+	if c.tooLarge(key, value) {
+		c.Remove(key)
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.update(e, value, expire)
+		c.promote(e)
+		c.evict(false)
+		return
+	}
+	e := &entry{key: key, value: value, expire: expire, size: entrySize(key, value)}
+	g, ok := c.ghosts[key]
+	if !ok {
+		c.insert(e, &c.t1)
+		c.evict(false)
+		c.trimGhosts()
+		return
+	}
+	inB2 := g.q == &c.b2
+	if inB2 {
+		c.p -= maxInt64(e.size, e.size*c.b1.bytes/c.b2.bytes)
+		if c.p < 0 {
+			c.p = 0
+		}
+	} else {
+		c.p += maxInt64(e.size, e.size*c.b2.bytes/c.b1.bytes)
+		if c.maxBytes != 0 && c.p > c.maxBytes {
+			c.p = c.maxBytes
+		}
+	}
+	c.forget(g)
+	c.insert(e, &c.t2) //曾经被淘汰又被再次访问，说明不是一次性的访问
+	c.evict(inB2)
+	c.trimGhosts()
+}
+
+func (c *arcCache) Get(key string) (Value, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if c.expired(e) {
+		c.drop(e)
+		return nil, false
+	}
+	c.promote(e)
+	return e.value, true
+}
+
+// 再次访问的记录移到 t2 的最前面
+func (c *arcCache) promote(e *entry) {
+	if e.q == &c.t2 {
+		c.t2.moveToFront(e)
+		return
+	}
+	e.q.remove(e)
+	c.t2.pushFront(e)
+}
+
+func (c *arcCache) evict(inB2 bool) {
+	for c.overflow() {
+		c.replace(inB2)
+	}
+}
+
+// t1 超过目标大小时淘汰 t1 中最早的记录，否则淘汰 t2 中最久未访问的记录，被淘汰的 key 进入对应的幽灵队列
+func (c *arcCache) replace(inB2 bool) {
+	if c.t1.len() > 0 && (c.t1.bytes > c.p || (inB2 && c.t1.bytes == c.p) || c.t2.len() == 0) {
+		c.demote(c.t1.back(), &c.b1)
+	} else if c.t2.len() > 0 {
+		c.demote(c.t2.back(), &c.b2)
+	}
+}
+
+func (c *arcCache) demote(e *entry, ghost *queue) {
+	c.drop(e)
+	g := &entry{key: e.key, size: e.size}
+	ghost.pushFront(g)
+	c.ghosts[g.key] = g
+}
+
+func (c *arcCache) forget(g *entry) {
+	g.q.remove(g)
+	delete(c.ghosts, g.key)
+}
+
+// 限制幽灵队列的大小：t1+b1 不超过 maxBytes，全部队列不超过 2*maxBytes；限制记录数时条数也同样限制
+func (c *arcCache) trimGhosts() {
+	if c.maxEntries > 0 {
+		for c.t1.len()+c.b1.len() > c.maxEntries && c.b1.len() > 0 {
+			c.forget(c.b1.back())
+		}
+		for c.t1.len()+c.t2.len()+c.b1.len()+c.b2.len() > 2*c.maxEntries && c.b2.len() > 0 {
+			c.forget(c.b2.back())
+		}
+	}
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.t1.bytes+c.b1.bytes > c.maxBytes && c.b1.len() > 0 {
+		c.forget(c.b1.back())
+	}
+	for c.t1.bytes+c.t2.bytes+c.b1.bytes+c.b2.bytes > 2*c.maxBytes && c.b2.len() > 0 {
+		c.forget(c.b2.back())
+	}
+}
+
+func (c *arcCache) Remove(key string) bool {
+	if e, ok := c.items[key]; ok {
+		c.drop(e)
+		return true
+	}
+	return false
+}
+
+func (c *arcCache) RemoveOldest() {
+	c.replace(false)
+}
+
+func (c *arcCache) RemoveExpired() int {
+	return c.removeExpired(c.drop)
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"container/heap"
+	"time"
+)
+
+// LFU 淘汰访问次数最少的记录，次数相同时淘汰最久未访问的记录。
+// 访问次数不会衰减，曾经的热点数据会一直留在缓存中，访问模式变化较快时建议使用 TinyLFU
+func LFU(maxBytes int64, onEvicted func(key string, value Value), now func() time.Time) Cache {
+	return &lfuCache{base: newBase(maxBytes, onEvicted, now)}
+}
+
+type lfuCache struct {
+	base
+	heap lfuHeap //按访问次数排列的最小堆，堆顶是下一个被淘汰的记录
+	tick uint64
+}
+
+func (c *lfuCache) AddWithExpire(key string, value Value, expire time.Time) {
+	if c.tooLarge(key, value) {
+		c.Remove(key)
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.update(e, value, expire)
+		c.touch(e)
+	} else {
+		c.tick++
+		e := &entry{key: key, value: value, expire: expire, size: entrySize(key, value), freq: 1, tick: c.tick}
+		c.insert(e, nil)
+		heap.Push(&c.heap, e)
+	}
+	for c.overflow() {
+		c.RemoveOldest()
+	}
+}
+
+func (c *lfuCache) Get(key string) (Value, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if c.expired(e) {
+		c.remove(e)
+		return nil, false
+	}
+	c.touch(e)
+	return e.value, true
+}
+
+func (c *lfuCache) touch(e *entry) {
+	c.tick++
+	e.freq++
+	e.tick = c.tick
+	heap.Fix(&c.heap, e.index)
+}
+
+func (c *lfuCache) Remove(key string) bool {
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+		return true
+	}
+	return false
+}
+
+func (c *lfuCache) RemoveOldest() {
+	if len(c.heap) > 0 {
+		c.remove(c.heap[0])
+	}
+}
+
+func (c *lfuCache) RemoveExpired() int {
+	return c.removeExpired(c.remove)
+}
+
+func (c *lfuCache) remove(e *entry) {
+	heap.Remove(&c.heap, e.index)
+	c.drop(e)
+}
+
+type lfuHeap []*entry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
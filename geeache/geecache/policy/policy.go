@@ -0,0 +1,213 @@
+package policy
+
+/**
+缓存淘汰策略：缓存超过内存上限时，决定淘汰哪一条记录
+LRU       淘汰最近最少访问的记录，实现见 lru 包
+LFU       淘汰访问次数最少的记录
+ARC       同时维护"最近访问"与"频繁访问"两个队列，根据幽灵记录的命中情况自适应地调整两者的大小
+2Q        新记录先进入 FIFO 队列，被淘汰后再次访问才进入 LRU 队列，一次性的扫描不会冲掉热点数据
+W-TinyLFU 新记录先进入窗口 LRU，离开窗口时与主缓存的淘汰候选比较 count-min sketch 估计的访问频率，频率更高者留下
+*/
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value 与 lru.Value 相同，Len 返回值所占用的内存大小
+type Value = lru.Value
+
+// Cache 是按某种淘汰策略管理的缓存，lru.Cache 也实现了该接口。所有实现都不是并发安全的。
+// 记录因为容量、过期或 Remove 被移除时都会调用创建时传入的 onEvicted
+type Cache interface {
+	// AddWithExpire 添加或更新一个值，到达 expire 之后视为不存在，expire 为零值时永不过期
+	AddWithExpire(key string, value Value, expire time.Time)
+	Get(key string) (Value, bool)
+	// Remove 移除 key 对应的记录，返回 key 是否存在
+	Remove(key string) bool
+	// RemoveOldest 按淘汰策略移除一条记录
+	RemoveOldest()
+	// RemoveExpired 移除所有已过期的记录，返回移除的个数
+	RemoveExpired() int
+	// Bytes 返回当前已使用的内存
+	Bytes() int64
+	Len() int
+}
+
+// EntryLimiter 由可以限制记录数的缓存实现，本包的所有策略和 lru.Cache 都实现了该接口。
+// 记录数超过 n 时按淘汰策略移除记录，n <= 0 表示不限制；应该在加入记录之前调用
+type EntryLimiter interface {
+	SetMaxEntries(n int)
+}
+
+// Factory 创建一个淘汰策略，maxBytes 为 0 时不限制内存，now 为 nil 时使用 time.Now
+type Factory func(maxBytes int64, onEvicted func(key string, value Value), now func() time.Time) Cache
+
+// LRU 创建 lru.Cache，是 geecache 默认的淘汰策略
+func LRU(maxBytes int64, onEvicted func(key string, value Value), now func() time.Time) Cache {
+	c := lru.New(maxBytes, onEvicted)
+	if now != nil {
+		c.Now = now
+	}
+	return c
+}
+
+// 缓存中的一条记录。幽灵记录(ghost)只保存 key 和大小，用于记住最近被淘汰的 key
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time //过期时间，零值表示永不过期
+	size   int64     //按 lru.EntrySize 计算的大小
+
+	q   *queue        //所在的队列，LFU 中为 nil
+	ele *list.Element //在队列中对应的节点
+
+	//LFU 使用
+	freq  int
+	tick  uint64 //最后一次访问的序号，访问次数相同时淘汰更早访问的记录
+	index int    //在堆中的下标
+}
+
+// 与 lru 使用相同的内存模型，各策略的节点结构不同，EntryOverhead 只是近似值
+func entrySize(key string, value Value) int64 {
+	return lru.EntrySize(key, value)
+}
+
+// 双向链表实现的队列，Front 是最近加入或访问的一端，同时记录队列中记录的总大小
+type queue struct {
+	ll    *list.List
+	bytes int64
+}
+
+func newQueue() queue {
+	return queue{ll: list.New()}
+}
+
+func (q *queue) pushFront(e *entry) {
+	e.q = q
+	e.ele = q.ll.PushFront(e)
+	q.bytes += e.size
+}
+
+func (q *queue) remove(e *entry) {
+	q.ll.Remove(e.ele)
+	q.bytes -= e.size
+	e.q, e.ele = nil, nil
+}
+
+func (q *queue) moveToFront(e *entry) {
+	q.ll.MoveToFront(e.ele)
+}
+
+// 最早加入或最久未访问的记录，队列为空时返回 nil
+func (q *queue) back() *entry {
+	if ele := q.ll.Back(); ele != nil {
+		return ele.Value.(*entry)
+	}
+	return nil
+}
+
+func (q *queue) len() int {
+	return q.ll.Len()
+}
+
+// 各策略共用的部分：记录的索引、内存统计、过期判断和移除回调
+type base struct {
+	maxBytes   int64
+	maxEntries int //允许保存的最大记录数，0 表示不限制
+	nbytes     int64
+	items      map[string]*entry
+	onEvicted  func(key string, value Value)
+	now        func() time.Time
+}
+
+func newBase(maxBytes int64, onEvicted func(string, Value), now func() time.Time) base {
+	if now == nil {
+		now = time.Now
+	}
+	return base{maxBytes: maxBytes, items: make(map[string]*entry), onEvicted: onEvicted, now: now}
+}
+
+func (b *base) expired(e *entry) bool {
+	return !e.expire.IsZero() && !b.now().Before(e.expire)
+}
+
+// 比 maxBytes 还大的值直接拒绝，避免为它淘汰掉所有的记录
+func (b *base) tooLarge(key string, value Value) bool {
+	return b.maxBytes != 0 && entrySize(key, value) > b.maxBytes
+}
+
+func (b *base) SetMaxEntries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	b.maxEntries = n
+}
+
+func (b *base) overflow() bool {
+	return (b.maxBytes != 0 && b.nbytes > b.maxBytes) || (b.maxEntries > 0 && len(b.items) > b.maxEntries)
+}
+
+// 记录新的值，所在队列的大小同步更新
+func (b *base) update(e *entry, value Value, expire time.Time) {
+	size := entrySize(e.key, value)
+	b.nbytes += size - e.size
+	if e.q != nil {
+		e.q.bytes += size - e.size
+	}
+	e.value, e.expire, e.size = value, expire, size
+}
+
+func (b *base) insert(e *entry, q *queue) {
+	b.items[e.key] = e
+	b.nbytes += e.size
+	if q != nil {
+		q.pushFront(e)
+	}
+}
+
+// 从所在队列和索引中移除记录并调用回调
+func (b *base) drop(e *entry) {
+	if e.q != nil {
+		e.q.remove(e)
+	}
+	delete(b.items, e.key)
+	b.nbytes -= e.size
+	if b.onEvicted != nil {
+		b.onEvicted(e.key, e.value)
+	}
+}
+
+// 遍历所有记录，用 remove 移除已过期的记录
+func (b *base) removeExpired(remove func(e *entry)) int {
+	removed := 0
+	for _, e := range b.items {
+		if b.expired(e) {
+			remove(e)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (b *base) Bytes() int64 {
+	return b.nbytes
+}
+
+func (b *base) Len() int {
+	return len(b.items)
+}
+
+var (
+	_ Factory = LRU
+	_ Factory = LFU
+	_ Factory = ARC
+	_ Factory = TwoQueue
+	_ Factory = TinyLFU
+
+	_ EntryLimiter = (*lru.Cache)(nil)
+	_ EntryLimiter = (*lfuCache)(nil)
+	_ EntryLimiter = (*arcCache)(nil)
+	_ EntryLimiter = (*twoQueueCache)(nil)
+	_ EntryLimiter = (*tinyLFUCache)(nil)
+)
@@ -0,0 +1,286 @@
+package policy
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+var policies = []struct {
+	name string
+	new  Factory
+}{
+	{"LRU", LRU},
+	{"LFU", LFU},
+	{"ARC", ARC},
+	{"2Q", TwoQueue},
+	{"TinyLFU", TinyLFU},
+}
+
+// 所有策略都要满足的基本约定
+func TestPolicies(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			now := time.Unix(1000, 0)
+			var evicted []string
+			c := p.new(0, func(key string, value Value) { evicted = append(evicted, key) }, func() time.Time { return now })
+
+			c.AddWithExpire("key1", String("1234"), time.Time{})
+			if v, ok := c.Get("key1"); !ok || v.(String) != "1234" {
+				t.Fatalf("缓存命中 key1=1234 failed")
+			}
+			if _, ok := c.Get("key2"); ok {
+				t.Fatalf("cache miss key2 failed")
+			}
+			c.AddWithExpire("key1", String("1"), time.Time{})
+			if c.Bytes() != entrySize("key1", String("1")) || c.Len() != 1 {
+				t.Fatalf("更新后 Bytes()=%d Len()=%d", c.Bytes(), c.Len())
+			}
+
+			c.AddWithExpire("short", String("v"), now.Add(time.Second))
+			c.AddWithExpire("long", String("v"), now.Add(time.Minute))
+			now = now.Add(2 * time.Second)
+			if _, ok := c.Get("short"); ok {
+				t.Fatalf("过期的 short 不应该命中")
+			}
+			now = now.Add(time.Hour)
+			if n := c.RemoveExpired(); n != 1 || c.Len() != 1 {
+				t.Fatalf("RemoveExpired 应该只移除 long，移除了 %d 个，剩余 %d 个", n, c.Len())
+			}
+			if !c.Remove("key1") || c.Remove("key1") || c.Len() != 0 || c.Bytes() != 0 {
+				t.Fatalf("Remove 之后缓存应该为空")
+			}
+			sort.Strings(evicted)
+			if !reflect.DeepEqual(evicted, []string{"key1", "long", "short"}) {
+				t.Fatalf("移除记录都应该调用 onEvicted，got %v", evicted)
+			}
+		})
+	}
+}
+
+// 比 maxBytes 还大的值被拒绝，不会淘汰已有的记录
+func TestPoliciesRejectOversize(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			evicted := 0
+			c := p.new(4*entrySize("k1", String("v1")), func(string, Value) { evicted++ }, nil)
+			c.AddWithExpire("k1", String("v1"), time.Time{})
+			c.AddWithExpire("k2", String("v2"), time.Time{})
+			c.AddWithExpire("big", String(make([]byte, 1000)), time.Time{})
+			if c.Len() != 2 || evicted != 0 {
+				t.Fatalf("Len()=%d evicted=%d", c.Len(), evicted)
+			}
+		})
+	}
+}
+
+// 无论如何淘汰，内存都不能超过上限
+func TestPoliciesMaxBytes(t *testing.T) {
+	maxBytes := 10 * entrySize("100", String("0123456789"))
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			evicted := 0
+			c := p.new(maxBytes, func(string, Value) { evicted++ }, nil)
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 10000; i++ {
+				key := strconv.Itoa(r.Intn(500))
+				if _, ok := c.Get(key); !ok {
+					c.AddWithExpire(key, String("0123456789"), time.Time{})
+				}
+				if c.Bytes() > maxBytes {
+					t.Fatalf("Bytes()=%d 超过了上限", c.Bytes())
+				}
+			}
+			if c.Len() == 0 || evicted == 0 {
+				t.Fatalf("Len()=%d evicted=%d", c.Len(), evicted)
+			}
+			for c.Len() > 0 {
+				c.RemoveOldest()
+			}
+			if c.Bytes() != 0 {
+				t.Fatalf("清空后 Bytes()=%d", c.Bytes())
+			}
+		})
+	}
+}
+
+// 限制记录数时，无论是否同时限制内存，记录数都不能超过上限
+func TestPoliciesMaxEntries(t *testing.T) {
+	for _, maxBytes := range []int64{0, 1 << 20} {
+		for _, p := range policies {
+			t.Run(p.name+"/"+strconv.FormatInt(maxBytes, 10), func(t *testing.T) {
+				evicted := 0
+				c := p.new(maxBytes, func(string, Value) { evicted++ }, nil)
+				c.(EntryLimiter).SetMaxEntries(10)
+				r := rand.New(rand.NewSource(1))
+				for i := 0; i < 10000; i++ {
+					key := strconv.Itoa(r.Intn(100))
+					if _, ok := c.Get(key); !ok {
+						c.AddWithExpire(key, String("v"), time.Time{})
+					}
+					if c.Len() > 10 {
+						t.Fatalf("Len()=%d 超过了上限", c.Len())
+					}
+				}
+				if c.Len() == 0 || evicted == 0 {
+					t.Fatalf("Len()=%d evicted=%d", c.Len(), evicted)
+				}
+			})
+		}
+	}
+}
+
+func TestLFU(t *testing.T) {
+	c := LFU(3*entrySize("k1", String("v1")), nil, nil)
+	c.AddWithExpire("k1", String("v1"), time.Time{})
+	c.AddWithExpire("k2", String("v2"), time.Time{})
+	c.AddWithExpire("k3", String("v3"), time.Time{})
+	c.Get("k1")
+	c.Get("k1")
+	c.Get("k3")
+	c.AddWithExpire("k4", String("v4"), time.Time{})
+	if _, ok := c.Get("k2"); ok {
+		t.Fatalf("访问次数最少的 k2 应该被淘汰")
+	}
+	if _, ok := c.Get("k1"); !ok {
+		t.Fatalf("k1 应该保留")
+	}
+}
+
+// 反复访问一组热点 key 之后进行一次全量扫描，抗扫描的策略应该保留大部分热点
+func TestScanResistance(t *testing.T) {
+	const hot = 50
+	entryBytes := entrySize("hot100", String("value-"))
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(100*entryBytes, nil, nil)
+			access := func(key string) {
+				if _, ok := c.Get(key); !ok {
+					c.AddWithExpire(key, String("value-"), time.Time{})
+				}
+			}
+			for round := 0; round < 5; round++ {
+				for i := 0; i < hot; i++ {
+					access("hot" + strconv.Itoa(100+i))
+				}
+			}
+			for i := 0; i < 1000; i++ {
+				access("scan" + strconv.Itoa(1000 + i)[1:])
+			}
+			kept := 0
+			for i := 0; i < hot; i++ {
+				if _, ok := c.Get("hot" + strconv.Itoa(100+i)); ok {
+					kept++
+				}
+			}
+			t.Logf("%s 保留了 %d/%d 个热点", p.name, kept, hot)
+			if p.name != "LRU" && kept < hot/2 {
+				t.Fatalf("扫描之后只保留了 %d/%d 个热点", kept, hot)
+			}
+		})
+	}
+}
+
+func TestCMSketch(t *testing.T) {
+	s := newCMSketch(64)
+	for i := 0; i < 10; i++ {
+		s.increment("hot")
+	}
+	s.increment("cold")
+	if s.estimate("hot") < 10 || s.estimate("hot") <= s.estimate("cold") {
+		t.Fatalf("hot=%d cold=%d", s.estimate("hot"), s.estimate("cold"))
+	}
+	for i := 0; i < 100; i++ {
+		s.increment("hot")
+	}
+	if s.estimate("hot") != cmMaxCount {
+		t.Fatalf("计数应该停在上限，got %d", s.estimate("hot"))
+	}
+	s.reset()
+	if s.estimate("hot") != cmMaxCount/2 {
+		t.Fatalf("reset 之后计数应该减半，got %d", s.estimate("hot"))
+	}
+}
+
+// 按 Zipf 分布生成的访问序列，s 越大访问越集中
+func zipfTrace(n, keys int, s float64, seed int64) []string {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, s, 1, uint64(keys-1))
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = strconv.FormatUint(z.Uint64(), 10)
+	}
+	return trace
+}
+
+// 在 Zipf 访问序列中每隔一段插入一次性的顺序扫描
+func scanTrace(n, keys int, s float64, seed int64) []string {
+	trace := zipfTrace(n, keys, s, seed)
+	scan := 0
+	for i := 0; i+500 <= len(trace); i += 5000 {
+		for j := 0; j < 500; j++ {
+			trace[i+j] = "scan" + strconv.Itoa(scan)
+			scan++
+		}
+	}
+	return trace
+}
+
+const benchEntryBytes = 16
+
+type fixed int
+
+func (fixed) Len() int { return benchEntryBytes }
+
+// 重放访问序列，未命中时加入缓存。先完整重放一遍预热，再以第二遍的命中率作为 hit%，
+// 命中率只取决于访问序列，与 b.N 无关；计时部分在预热后的缓存上继续重放
+func benchmarkHitRatio(b *testing.B, trace []string, entries int) {
+	for _, p := range policies {
+		c := p.new(int64(entries)*entrySize("12345", fixed(0)), nil, nil)
+		for _, key := range trace {
+			access(c, key)
+		}
+		hits := 0
+		for _, key := range trace {
+			if access(c, key) {
+				hits++
+			}
+		}
+		b.Run(p.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				access(c, trace[i%len(trace)])
+			}
+			b.ReportMetric(100*float64(hits)/float64(len(trace)), "hit%")
+		})
+	}
+}
+
+// 访问一个 key，未命中时加入缓存，返回是否命中
+func access(c Cache, key string) bool {
+	if _, ok := c.Get(key); ok {
+		return true
+	}
+	c.AddWithExpire(key, fixed(0), time.Time{})
+	return false
+}
+
+func BenchmarkHitRatioZipf(b *testing.B) {
+	benchmarkHitRatio(b, zipfTrace(1<<20, 100000, 1.01, 1), 1000)
+}
+
+func BenchmarkHitRatioZipfSkewed(b *testing.B) {
+	benchmarkHitRatio(b, zipfTrace(1<<20, 100000, 1.2, 1), 1000)
+}
+
+func BenchmarkHitRatioZipfWithScans(b *testing.B) {
+	benchmarkHitRatio(b, scanTrace(1<<20, 100000, 1.01, 1), 1000)
+}
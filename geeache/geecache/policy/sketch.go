@@ -0,0 +1,84 @@
+package policy
+
+const (
+	cmDepth      = 4  //计数器的行数，估计值取各行的最小值
+	cmMaxCount   = 15 //计数器的上限，TinyLFU 只需要区分频率的高低
+	cmMinWidth   = 16
+	cmMaxWidth   = 1 << 24
+	cmSampleRate = 10 //累计增加 宽度*cmSampleRate 次后所有计数减半
+)
+
+// cmSketch 是 count-min sketch，用固定大小的计数器估计 key 的访问频率。
+// 不同的 key 可能共用计数器，所以估计值只会偏大不会偏小；每行使用不同的哈希，取最小值可以减小误差
+type cmSketch struct {
+	rows       [cmDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+// width 是每行计数器的个数，向上取整为 2 的幂，一般设为预计的记录条数
+func newCMSketch(width int) *cmSketch {
+	w := cmMinWidth
+	for w < width && w < cmMaxWidth {
+		w <<= 1
+	}
+	s := &cmSketch{mask: uint64(w - 1), sampleSize: w * cmSampleRate}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+func (s *cmSketch) increment(key string) {
+	h := hashKey(key)
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < cmMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) estimate(key string) uint8 {
+	h := hashKey(key)
+	min := uint8(cmMaxCount)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// 所有计数减半(老化)，让过去的热点数据逐渐冷却
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// 每行使用不同的种子打散同一个哈希值(splitmix64 的混合函数)
+func (s *cmSketch) index(h uint64, row int) uint64 {
+	x := h + uint64(row+1)*0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return x & s.mask
+}
+
+// FNV-1a，直接遍历字符串避免 hash.Hash 的内存分配
+func hashKey(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
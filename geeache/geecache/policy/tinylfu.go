@@ -0,0 +1,173 @@
+package policy
+
+import (
+	"geecache/lru"
+	"time"
+)
+
+const (
+	tinyLFUWindowRatio    = 0.01 //窗口 LRU 约占 maxBytes 的 1%
+	tinyLFUProtectedRatio = 0.8  //protected 约占主缓存的 80%
+	tinyLFUAvgValueBytes  = 64   //估算记录条数时假定的平均值大小，加上 lru.EntryOverhead 用于确定 sketch 的宽度
+)
+
+// TinyLFU 实现 W-TinyLFU：新记录先进入很小的窗口 LRU，离开窗口时与主缓存的淘汰候选比较
+// count-min sketch 估计的访问频率，频率更高的留下(准入过滤)。主缓存是分段 LRU：
+// 第一次进入主缓存的记录在 probation 中，再次访问后进入 protected。
+// sketch 中的计数会定期减半，访问模式变化后旧的热点数据会逐渐被淘汰
+func TinyLFU(maxBytes int64, onEvicted func(key string, value Value), now func() time.Time) Cache {
+	windowBytes := int64(float64(maxBytes) * tinyLFUWindowRatio)
+	if windowBytes == 0 && maxBytes > 0 {
+		windowBytes = 1
+	}
+	return &tinyLFUCache{
+		base:           newBase(maxBytes, onEvicted, now),
+		window:         newQueue(),
+		probation:      newQueue(),
+		protected:      newQueue(),
+		sketch:         newCMSketch(int(maxBytes / (lru.EntryOverhead + tinyLFUAvgValueBytes))),
+		windowBytes:    windowBytes,
+		protectedBytes: int64(float64(maxBytes-windowBytes) * tinyLFUProtectedRatio),
+	}
+}
+
+type tinyLFUCache struct {
+	base
+	window         queue //窗口 LRU，新记录先进入这里
+	probation      queue //主缓存中还没有被再次访问的记录
+	protected      queue //主缓存中被再次访问过的记录
+	sketch         *cmSketch
+	windowBytes    int64
+	protectedBytes int64
+	//限制记录数时各段按条数划分，比例与按内存划分时相同
+	windowEntries    int
+	protectedEntries int
+}
+
+func (c *tinyLFUCache) AddWithExpire(key string, value Value, expire time.Time) {
+	if c.tooLarge(key, value) {
+		c.Remove(key)
+		return
+	}
+	c.sketch.increment(key)
+	if e, ok := c.items[key]; ok {
+		c.update(e, value, expire)
+		c.touch(e)
+	} else {
+		c.insert(&entry{key: key, value: value, expire: expire, size: entrySize(key, value)}, &c.window)
+	}
+	if c.maxBytes == 0 && c.maxEntries == 0 {
+		return
+	}
+	for c.windowFull() {
+		candidate := c.window.back()
+		c.window.remove(candidate)
+		c.admit(candidate)
+	}
+	for c.overflow() {
+		c.RemoveOldest()
+	}
+}
+
+// 离开窗口的候选记录进入主缓存：空间不足时与 probation(为空时 protected)中最久未访问的记录比较访问频率，
+// 候选者频率更高则淘汰对方，否则淘汰候选者
+func (c *tinyLFUCache) admit(candidate *entry) {
+	for c.mainFull(candidate) {
+		victim := c.probation.back()
+		if victim == nil {
+			victim = c.protected.back()
+		}
+		if victim == nil || c.sketch.estimate(candidate.key) <= c.sketch.estimate(victim.key) {
+			c.drop(candidate)
+			return
+		}
+		c.drop(victim)
+	}
+	c.probation.pushFront(candidate)
+}
+
+// 按记录数划分窗口和 protected，并重新确定 sketch 的宽度
+func (c *tinyLFUCache) SetMaxEntries(n int) {
+	c.base.SetMaxEntries(n)
+	if c.maxEntries == 0 {
+		return
+	}
+	c.windowEntries = int(float64(c.maxEntries) * tinyLFUWindowRatio)
+	if c.windowEntries == 0 {
+		c.windowEntries = 1
+	}
+	c.protectedEntries = int(float64(c.maxEntries-c.windowEntries) * tinyLFUProtectedRatio)
+	c.sketch = newCMSketch(c.maxEntries)
+}
+
+// 窗口超出按内存或按条数的上限，候选记录需要离开窗口
+func (c *tinyLFUCache) windowFull() bool {
+	if c.window.len() == 0 {
+		return false
+	}
+	return (c.maxBytes != 0 && c.window.bytes > c.windowBytes) ||
+		(c.maxEntries > 0 && c.window.len() > c.windowEntries)
+}
+
+// 主缓存放不下 candidate
+func (c *tinyLFUCache) mainFull(candidate *entry) bool {
+	return (c.maxBytes != 0 && c.probation.bytes+c.protected.bytes+candidate.size > c.maxBytes-c.windowBytes) ||
+		(c.maxEntries > 0 && c.probation.len()+c.protected.len()+1 > c.maxEntries-c.windowEntries)
+}
+
+func (c *tinyLFUCache) protectedFull() bool {
+	return (c.maxBytes != 0 && c.protected.bytes > c.protectedBytes) ||
+		(c.maxEntries > 0 && c.protected.len() > c.protectedEntries)
+}
+
+func (c *tinyLFUCache) Get(key string) (Value, bool) {
+	c.sketch.increment(key) //未命中也计数，之后加入时才能与已有的记录比较频率
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if c.expired(e) {
+		c.drop(e)
+		return nil, false
+	}
+	c.touch(e)
+	return e.value, true
+}
+
+// probation 中的记录被再次访问时进入 protected，protected 超出大小时把最久未访问的记录降回 probation
+func (c *tinyLFUCache) touch(e *entry) {
+	switch e.q {
+	case &c.window, &c.protected:
+		e.q.moveToFront(e)
+	case &c.probation:
+		c.probation.remove(e)
+		c.protected.pushFront(e)
+		for c.protectedFull() && c.protected.len() > 1 {
+			demoted := c.protected.back()
+			c.protected.remove(demoted)
+			c.probation.pushFront(demoted)
+		}
+	}
+}
+
+func (c *tinyLFUCache) Remove(key string) bool {
+	if e, ok := c.items[key]; ok {
+		c.drop(e)
+		return true
+	}
+	return false
+}
+
+// 依次从 probation、窗口、protected 中淘汰最久未访问的记录
+func (c *tinyLFUCache) RemoveOldest() {
+	for _, q := range []*queue{&c.probation, &c.window, &c.protected} {
+		if e := q.back(); e != nil {
+			c.drop(e)
+			return
+		}
+	}
+}
+
+func (c *tinyLFUCache) RemoveExpired() int {
+	return c.removeExpired(c.drop)
+}
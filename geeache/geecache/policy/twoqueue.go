@@ -0,0 +1,129 @@
+package policy
+
+import "time"
+
+const (
+	twoQueueInRatio  = 0.25 //A1in 约占 maxBytes 的 1/4
+	twoQueueOutRatio = 0.5  //A1out 中幽灵记录的总大小不超过 maxBytes 的 1/2
+)
+
+// TwoQueue 实现 2Q 算法：新记录先进入 FIFO 队列 A1in，被再次访问后进入 LRU 队列 Am；
+// 从 A1in 淘汰的 key 记录在幽灵队列 A1out 中，A1out 中的 key 再次加入时直接进入 Am。
+// 只访问一次的记录(例如一次全表扫描)只会占用 A1in，不会冲掉 Am 中的热点数据
+func TwoQueue(maxBytes int64, onEvicted func(key string, value Value), now func() time.Time) Cache {
+	return &twoQueueCache{
+		base:   newBase(maxBytes, onEvicted, now),
+		in:     newQueue(),
+		am:     newQueue(),
+		out:    newQueue(),
+		ghosts: make(map[string]*entry),
+		kin:    int64(float64(maxBytes) * twoQueueInRatio),
+		kout:   int64(float64(maxBytes) * twoQueueOutRatio),
+	}
+}
+
+type twoQueueCache struct {
+	base
+	in     queue             //A1in，只访问过一次的记录，FIFO
+	am     queue             //Am，LRU
+	out    queue             //A1out，从 A1in 淘汰的幽灵记录
+	ghosts map[string]*entry //A1out 中的幽灵记录
+	kin    int64
+	kout   int64
+}
+
+func (c *twoQueueCache) AddWithExpire(key string, value Value, expire time.Time) {
+	if c.tooLarge(key, value) {
+		c.Remove(key)
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.update(e, value, expire)
+		c.promote(e)
+	} else {
+		e := &entry{key: key, value: value, expire: expire, size: entrySize(key, value)}
+		if g, ok := c.ghosts[key]; ok {
+			c.forget(g)
+			c.insert(e, &c.am)
+		} else {
+			c.insert(e, &c.in)
+		}
+	}
+	for c.overflow() {
+		c.RemoveOldest()
+	}
+}
+
+func (c *twoQueueCache) Get(key string) (Value, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if c.expired(e) {
+		c.drop(e)
+		return nil, false
+	}
+	c.promote(e)
+	return e.value, true
+}
+
+func (c *twoQueueCache) promote(e *entry) {
+	if e.q == &c.am {
+		c.am.moveToFront(e)
+		return
+	}
+	c.in.remove(e)
+	c.am.pushFront(e)
+}
+
+func (c *twoQueueCache) Remove(key string) bool {
+	if e, ok := c.items[key]; ok {
+		c.drop(e)
+		return true
+	}
+	return false
+}
+
+// A1in 超过 kin 或 Am 为空时淘汰 A1in 中最早的记录并记入 A1out，否则淘汰 Am 中最久未访问的记录
+func (c *twoQueueCache) RemoveOldest() {
+	if c.in.len() > 0 && (c.inFull() || c.am.len() == 0) {
+		e := c.in.back()
+		c.drop(e)
+		g := &entry{key: e.key, size: e.size}
+		c.out.pushFront(g)
+		c.ghosts[g.key] = g
+		for c.outFull() {
+			c.forget(c.out.back())
+		}
+	} else if c.am.len() > 0 {
+		c.drop(c.am.back())
+	}
+}
+
+// A1in 超过 kin，限制记录数时条数也不超过 maxEntries 的 1/4；只限制记录数时不按内存判断
+func (c *twoQueueCache) inFull() bool {
+	if c.maxEntries > 0 && c.in.len() > int(float64(c.maxEntries)*twoQueueInRatio) {
+		return true
+	}
+	return (c.maxBytes != 0 || c.maxEntries == 0) && c.in.bytes > c.kin
+}
+
+// A1out 超过 kout，限制记录数时条数也不超过 maxEntries 的 1/2
+func (c *twoQueueCache) outFull() bool {
+	if c.out.len() == 0 {
+		return false
+	}
+	if c.maxEntries > 0 && c.out.len() > int(float64(c.maxEntries)*twoQueueOutRatio) {
+		return true
+	}
+	return (c.maxBytes != 0 || c.maxEntries == 0) && c.out.bytes > c.kout
+}
+
+func (c *twoQueueCache) RemoveExpired() int {
+	return c.removeExpired(c.drop)
+}
+
+func (c *twoQueueCache) forget(g *entry) {
+	c.out.remove(g)
+	delete(c.ghosts, g.key)
+}
@@ -0,0 +1,111 @@
+package geecache
+
+import (
+	"geecache/lru"
+	"geecache/policy"
+	"sync/atomic"
+	"time"
+)
+
+// 每段至少能放下的记录数(按空记录的 lru.EntryOverhead 估算)，段太小时所有记录都会因为超出段的上限被拒绝
+const minShardEntries = 4
+
+// shardedCache 把缓存按 key 的哈希分为多段，每段是一个独立加锁的 cache，
+// 不同段的读写互不阻塞；内存上限平均分给各段，淘汰只在段内进行
+type shardedCache struct {
+	total  int64 //各段已使用内存的合计，由各段在修改后原子地更新，读取时不需要加锁
+	shards []cache
+	mask   uint32
+}
+
+// n 向上取整为 2 的幂，用位运算代替取模选择分段；
+// cacheBytes 或 maxEntries 平均到每段后放不下 minShardEntries 条记录时减少段数，因此实际段数可能少于 n。
+// maxEntries 按段数向上取整分给各段
+func newShardedCache(n int, cacheBytes int64, maxEntries int, newStore policy.Factory, now func() time.Time) *shardedCache {
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	for size > 1 && ((cacheBytes > 0 && cacheBytes/int64(size) < minShardEntries*lru.EntryOverhead) ||
+		(maxEntries > 0 && maxEntries/size < minShardEntries)) {
+		size >>= 1
+	}
+	s := &shardedCache{shards: make([]cache, size), mask: uint32(size - 1)}
+	for i := range s.shards {
+		s.shards[i].cacheBytes = cacheBytes / int64(size)
+		s.shards[i].maxEntries = (maxEntries + size - 1) / size
+		s.shards[i].newStore = newStore
+		s.shards[i].now = now
+		s.shards[i].total = &s.total
+	}
+	return s
+}
+
+// FNV-1a 哈希选择分段
+func (s *shardedCache) shard(key string) *cache {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &s.shards[h&s.mask]
+}
+
+func (s *shardedCache) add(key string, value ByteView, expire time.Time) {
+	s.shard(key).add(key, value, expire)
+}
+
+func (s *shardedCache) get(key string) (value ByteView, ok bool) {
+	return s.shard(key).get(key)
+}
+
+func (s *shardedCache) remove(key string) {
+	s.shard(key).remove(key)
+}
+
+func (s *shardedCache) purge() {
+	for i := range s.shards {
+		s.shards[i].purge()
+	}
+}
+
+func (s *shardedCache) removeExpired() int {
+	removed := 0
+	for i := range s.shards {
+		removed += s.shards[i].removeExpired()
+	}
+	return removed
+}
+
+// 从占用内存最多的段中淘汰一条缓存，选择时只读取各段的原子计数，只对被选中的段加锁
+func (s *shardedCache) removeOldest() {
+	var victim *cache
+	var max int64
+	for i := range s.shards {
+		if b := s.shards[i].bytes(); b > max {
+			victim, max = &s.shards[i], b
+		}
+	}
+	if victim != nil {
+		victim.removeOldest()
+	}
+}
+
+func (s *shardedCache) bytes() int64 {
+	return atomic.LoadInt64(&s.total)
+}
+
+func (s *shardedCache) stats() CacheStats {
+	var total CacheStats
+	for i := range s.shards {
+		st := s.shards[i].stats()
+		total.Bytes += st.Bytes
+		total.Items += st.Items
+		total.Gets += st.Gets
+		total.Hits += st.Hits
+		total.Evictions += st.Evictions
+	}
+	return total
+}
+
+var _ cacher = (*shardedCache)(nil)
@@ -0,0 +1,119 @@
+package geecache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"geecache/lru"
+)
+
+func TestShardedCache(t *testing.T) {
+	s := newShardedCache(6, 8<<10, 0, nil, nil)
+	if len(s.shards) != 8 || s.shards[0].cacheBytes != 1<<10 {
+		t.Fatalf("6 段应该向上取整为 8 段，每段 1KB，got %d 段 %d 字节", len(s.shards), s.shards[0].cacheBytes)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := "key" + strconv.Itoa(w*1000+i)
+				s.add(key, ByteView{b: []byte("0123456789")}, time.Time{})
+				s.get(key)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if b := s.bytes(); b == 0 || b > 8<<10 {
+		t.Fatalf("各段合计不应超过 cacheBytes，got %d", b)
+	}
+	st := s.stats()
+	if st.Gets != 8000 || st.Evictions == 0 || st.Bytes != s.bytes() {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	s.add("Tom", ByteView{b: []byte("630")}, time.Time{})
+	if v, ok := s.get("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("get(Tom) = %q, %v", v.String(), ok)
+	}
+	s.remove("Tom")
+	if _, ok := s.get("Tom"); ok {
+		t.Fatalf("remove 之后不应该命中")
+	}
+	s.purge()
+	if s.bytes() != 0 {
+		t.Fatalf("purge 之后应该为空")
+	}
+}
+
+func TestWithShards(t *testing.T) {
+	g := NewGroup("sharded-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithShards(4))
+	if _, ok := g.mainCache.(*shardedCache); !ok {
+		t.Fatalf("WithShards 应该使用 shardedCache")
+	}
+	g.Get("Tom")
+	if v, err := g.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("Get(Tom) = %q, %v", v.String(), err)
+	}
+	if st := g.Stats(); st.Hits != 1 || st.MainCache.Items != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+// 每段放不下几条记录时减少段数，而不是拒绝所有的写入
+func TestWithShardsSmallBudget(t *testing.T) {
+	g := NewGroup("sharded-small", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithShards(64))
+	s := g.mainCache.(*shardedCache)
+	if n := len(s.shards); n >= 64 || s.shards[0].cacheBytes < minShardEntries*lru.EntryOverhead {
+		t.Fatalf("段数应该减少，got %d 段，每段 %d 字节", n, s.shards[0].cacheBytes)
+	}
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		g.Get(key)
+	}
+	if st := g.Stats(); st.MainCache.Items != 3 || st.MainCache.Bytes != s.bytes() {
+		t.Fatalf("小内存上限下仍然应该能缓存，got %+v", st.MainCache)
+	}
+}
+
+// 多个 goroutine 以 9:1 的比例读写，比较单锁与分段的吞吐
+func benchmarkCacheParallel(b *testing.B, c cacher) {
+	const keys = 1 << 14
+	value := ByteView{b: make([]byte, 64)}
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = "key" + strconv.Itoa(i)
+		c.add(names[i], value, time.Time{})
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := names[(i*7919)&(keys-1)]
+			if i%10 == 0 {
+				c.add(key, value, time.Time{})
+			} else {
+				c.get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkCacheParallel(b *testing.B) {
+	benchmarkCacheParallel(b, &cache{cacheBytes: 4 << 20})
+}
+
+func BenchmarkShardedCacheParallel(b *testing.B) {
+	for _, n := range []int{4, 16, 64} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkCacheParallel(b, newShardedCache(n, 4<<20, 0, nil, nil))
+		})
+	}
+}
@@ -0,0 +1,37 @@
+//go:build go1.21
+// +build go1.21
+
+package geecache
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogLogger 把日志转发给 log/slog，级别一一对应
+type SlogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger 创建 slog 适配器，l 为 nil 时使用 slog.Default()
+func NewSlogLogger(l *slog.Logger) *SlogLogger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &SlogLogger{l: l}
+}
+
+func (s *SlogLogger) Enabled(level Level) bool {
+	return s.l.Enabled(context.Background(), slogLevel(level))
+}
+
+func (s *SlogLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slogLevel(level), msg, keyvals...)
+}
+
+// 两者的级别间隔相同：Debug=-4、Info=0、Warn=4、Error=8
+func slogLevel(level Level) slog.Level {
+	return slog.Level(level * 4)
+}
+
+var _ Logger = (*SlogLogger)(nil)
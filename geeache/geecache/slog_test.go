@@ -0,0 +1,25 @@
+//go:build go1.21
+// +build go1.21
+
+package geecache
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	if l.Enabled(LevelDebug) || !l.Enabled(LevelWarn) {
+		t.Fatalf("levels should map onto slog levels")
+	}
+	l.Log(LevelDebug, "hidden")
+	l.Log(LevelError, "owner peer", "key", "Tom")
+	got := buf.String()
+	if strings.Contains(got, "hidden") || !strings.Contains(got, "level=ERROR") || !strings.Contains(got, "key=Tom") {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
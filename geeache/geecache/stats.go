@@ -0,0 +1,146 @@
+package geecache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// AtomicInt 是可以并发累加的计数器
+type AtomicInt int64
+
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// Group 内部的计数器，不加锁
+type groupStats struct {
+	gets           AtomicInt // Get 的调用次数
+	hits           AtomicInt // mainCache 或 hotCache 命中的次数
+	peerLoads      AtomicInt // 从远程节点获取成功的次数
+	peerErrors     AtomicInt // 从远程节点获取失败的次数
+	localLoads     AtomicInt // 调用回调函数成功的次数
+	localLoadErrs  AtomicInt // 调用回调函数失败的次数
+	loadsDeduped   AtomicInt // 被 singleflight 合并、没有实际加载的次数
+	serverRequests AtomicInt // 其他节点通过 HTTP 发来的请求数
+}
+
+// GroupStats 是 Group 统计信息的快照
+type GroupStats struct {
+	Gets           int64      `json:"gets"`
+	Hits           int64      `json:"hits"`
+	PeerLoads      int64      `json:"peer_loads"`
+	PeerErrors     int64      `json:"peer_errors"`
+	LocalLoads     int64      `json:"local_loads"`
+	LocalLoadErrs  int64      `json:"local_load_errs"`
+	LoadsDeduped   int64      `json:"loads_deduped"`
+	ServerRequests int64      `json:"server_requests"`
+	MainCache      CacheStats `json:"main_cache"`
+	HotCache       CacheStats `json:"hot_cache"`
+}
+
+// CacheStats 是 mainCache 或 hotCache 的统计信息
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`
+	Items     int64 `json:"items"`
+	Gets      int64 `json:"gets"`
+	Hits      int64 `json:"hits"`
+	Evictions int64 `json:"evictions"` // 因为容量不足或过期被移除的条数，不含主动删除
+}
+
+// Stats 返回当前统计信息的快照
+func (g *Group) Stats() GroupStats {
+	return GroupStats{
+		Gets:           g.stats.gets.Get(),
+		Hits:           g.stats.hits.Get(),
+		PeerLoads:      g.stats.peerLoads.Get(),
+		PeerErrors:     g.stats.peerErrors.Get(),
+		LocalLoads:     g.stats.localLoads.Get(),
+		LocalLoadErrs:  g.stats.localLoadErrs.Get(),
+		LoadsDeduped:   g.stats.loadsDeduped.Get(),
+		ServerRequests: g.stats.serverRequests.Get(),
+		MainCache:      g.mainCache.stats(),
+		HotCache:       g.hotCache.stats(),
+	}
+}
+
+// 按名称排序的所有 Group
+func allGroups() []*Group {
+	mu.RLock()
+	all := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	return all
+}
+
+// 输出的指标：名称、类型、说明，以及从快照中取值的方法
+var groupMetrics = []struct {
+	name, typ, help string
+	value           func(s *GroupStats) int64
+}{
+	{"geecache_gets_total", "counter", "Total number of Group.Get calls.", func(s *GroupStats) int64 { return s.Gets }},
+	{"geecache_hits_total", "counter", "Number of gets served from mainCache or hotCache.", func(s *GroupStats) int64 { return s.Hits }},
+	{"geecache_peer_loads_total", "counter", "Number of values loaded from remote peers.", func(s *GroupStats) int64 { return s.PeerLoads }},
+	{"geecache_peer_errors_total", "counter", "Number of failed loads from remote peers.", func(s *GroupStats) int64 { return s.PeerErrors }},
+	{"geecache_local_loads_total", "counter", "Number of values loaded by the local getter.", func(s *GroupStats) int64 { return s.LocalLoads }},
+	{"geecache_local_load_errors_total", "counter", "Number of failed loads by the local getter.", func(s *GroupStats) int64 { return s.LocalLoadErrs }},
+	{"geecache_loads_deduped_total", "counter", "Number of loads merged by singleflight.", func(s *GroupStats) int64 { return s.LoadsDeduped }},
+	{"geecache_server_requests_total", "counter", "Number of requests received from peers.", func(s *GroupStats) int64 { return s.ServerRequests }},
+}
+
+var cacheMetrics = []struct {
+	name, typ, help string
+	value           func(s *CacheStats) int64
+}{
+	{"geecache_cache_bytes", "gauge", "Bytes used by the cache.", func(s *CacheStats) int64 { return s.Bytes }},
+	{"geecache_cache_items", "gauge", "Number of entries in the cache.", func(s *CacheStats) int64 { return s.Items }},
+	{"geecache_cache_gets_total", "counter", "Number of lookups in the cache.", func(s *CacheStats) int64 { return s.Gets }},
+	{"geecache_cache_hits_total", "counter", "Number of lookups that found an entry.", func(s *CacheStats) int64 { return s.Hits }},
+	{"geecache_cache_evictions_total", "counter", "Number of entries evicted for size or expiry.", func(s *CacheStats) int64 { return s.Evictions }},
+}
+
+// WritePrometheus 以 Prometheus 文本格式(text/plain; version=0.0.4)输出所有 Group 的统计信息
+func WritePrometheus(w io.Writer) error {
+	all := allGroups()
+	stats := make([]GroupStats, len(all))
+	for i, g := range all {
+		stats[i] = g.Stats()
+	}
+	buf := bufio.NewWriter(w)
+	for _, m := range groupMetrics {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for i, g := range all {
+			fmt.Fprintf(buf, "%s{group=\"%s\"} %d\n", m.name, escapeLabel(g.name), m.value(&stats[i]))
+		}
+	}
+	for _, m := range cacheMetrics {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for i, g := range all {
+			fmt.Fprintf(buf, "%s{group=\"%s\",cache=\"main\"} %d\n", m.name, escapeLabel(g.name), m.value(&stats[i].MainCache))
+			fmt.Fprintf(buf, "%s{group=\"%s\",cache=\"hot\"} %d\n", m.name, escapeLabel(g.name), m.value(&stats[i].HotCache))
+		}
+	}
+	return buf.Flush()
+}
+
+// 标签值中的反斜杠、双引号和换行需要转义
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -10,17 +10,24 @@ package main
 5.下次在访问相同的节点时，直接从本地mainCache中查找得到缓存
 
 结果分析：传入example -port=8001 & example -port=8002 & example -port=8003 -api=1 来启动3个服务端
+                 节点列表默认是固定的 8001/8002/8003，也可以通过 -peers-file(监视文件)、-dns(DNS 记录) 或
+                 -gossip/-join(SWIM 协议) 自动发现，例如 example -port=8002 -gossip=127.0.0.1:7002 -join=127.0.0.1:7001，
+                 集群中的节点应该通过 -gossip-key 使用相同的密钥签名 gossip 消息，否则任何人都可以伪造节点；
+                 使用 -dns 时需要用 -advertise 指定本机的 IP 地址，例如 example -port=8001 -dns=cache.local -advertise=http://10.0.0.1:8001
                  当并发了 3 个请求 ?key=Tom，从日志中可以看到，三次均选择了节点 8001，这是一致性哈希算法的功劳。
 	这仅仅同时向 8001 发起了 3 次请求，假如有 10 万个在并发请求该数据，那就会向 8001 同时发起 10 万次请求，如果 8001 又同时向数据库发起 10 万次查询请求，很容易导致缓存被击穿。
 	此时需要给请求加锁，当其他进程想要访问该请求时会阻塞，等待第一个访问这个请求的进程返回时一起返回响应。
 */
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"geecache"
+	"geecache/discovery"
 	"log"
 	"net/http"
+	"strings"
 )
 
 var db = map[string]string{
@@ -29,6 +36,9 @@ var db = map[string]string{
 	"Sam":  "567",
 } //使用 map 模拟数据源
 
+//示例中输出 Info 及以上级别的日志，排查问题时可以改为 geecache.LevelDebug
+var logger = geecache.NewStdLogger(geecache.LevelInfo)
+
 func createGroup() *geecache.Group {
 	return geecache.NewGroup("scores", 2<<10, geecache.GetterFunc(
 		func(key string) ([]byte, error) {
@@ -38,41 +48,78 @@ func createGroup() *geecache.Group {
 				return []byte(v), nil
 			}
 			return nil, fmt.Errorf("%s not exist", key)
-		}))
+		}), geecache.WithLogger(logger))
 }
 
-//启动缓存服务器：创建 HTTPPool，添加节点信息，注册到 gee 中，启动 HTTP 服务（共3个端口，8001/8002/8003）
-//addrs=[http://localhost:8001 http://localhost:8002 http://localhost:8003]
+//启动缓存服务器：创建 HTTPPool，由 d 发现节点信息，注册到 gee 中，启动 HTTP 服务
+//addr=http://localhost:8001 是其他节点访问自己的地址，必须与节点发现返回的写法一致，否则会把自己当成远程节点；
+//listen 是实际监听的地址
 
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
-	peers.Set(addrs...)  //注册虚拟节点并且注入节点和通讯地址的对应关系
+func startCacheServer(addr, listen, peerKey string, d discovery.Discovery, gee *geecache.Group) {
+	opts := []geecache.HTTPPoolOption{geecache.WithPoolLogger(logger)}
+	if peerKey != "" { //节点间的 Set/Remove/Purge 需要签名，没有密钥时节点端口只接受 GET
+		opts = append(opts, geecache.WithSecretKey([]byte(peerKey)))
+	}
+	peers := geecache.NewHTTPPool(addr, opts...)
+	go func() { //节点列表变化时增量更新虚拟节点和通讯地址的对应关系
+		if err := peers.Watch(context.Background(), d); err != nil {
+			log.Fatal(err)
+		}
+	}()
 	gee.RegisterPeers(peers)
-	log.Printf("geecache is running at %v--%v\n", addr,addr[7:])
-	log.Fatal(http.ListenAndServe(addr[7:], peers)) //会进入(p *HTTPPool) ServeHTTP
+	log.Printf("geecache is running at %v--%v\n", addr, listen)
+	log.Fatal(http.ListenAndServe(listen, peers)) //会进入(p *HTTPPool) ServeHTTP
+}
+
+//根据命令行参数选择节点发现的方式，都没有指定时使用固定的 3 个节点
+func newDiscovery(self string, port int, peersFile, dnsName, gossipAddr, join, gossipKey string) discovery.Discovery {
+	onError := func(err error) { logger.Log(geecache.LevelWarn, "节点发现失败", "err", err) }
+	switch {
+	case peersFile != "":
+		d := discovery.NewFile(peersFile)
+		d.OnError = onError
+		return d
+	case dnsName != "":
+		return &discovery.DNS{Name: dnsName, SRV: strings.HasPrefix(dnsName, "_"), Port: port, OnError: onError}
+	case gossipAddr != "":
+		var seeds []string
+		if join != "" {
+			seeds = strings.Split(join, ",")
+		}
+		g, err := discovery.NewGossip(discovery.GossipConfig{BindAddr: gossipAddr, Meta: self, Seeds: seeds, SecretKey: []byte(gossipKey)})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return g
+	}
+	return discovery.Static{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
 }
 
 func main() {
 	var port int
 	var api bool
+	var advertise, peersFile, dnsName, gossipAddr, join, gossipKey, peerKey string
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
-	//命令行传入 port 和 api 2 个参数，用来在指定端口启动 HTTP 服务
+	flag.StringVar(&advertise, "advertise", "", "URL other peers use to reach this node, e.g. http://10.0.0.1:8001 (default http://localhost:port)")
+	flag.StringVar(&peersFile, "peers-file", "", "File listing peer URLs, one per line")
+	flag.StringVar(&dnsName, "dns", "", "DNS name (A records, or SRV if it starts with _) resolving to peers")
+	flag.StringVar(&gossipAddr, "gossip", "", "UDP address for gossip membership, e.g. 127.0.0.1:7001")
+	flag.StringVar(&join, "join", "", "Comma-separated gossip addresses to join")
+	flag.StringVar(&gossipKey, "gossip-key", "", "Shared secret used to sign gossip messages")
+	flag.StringVar(&peerKey, "peer-key", "", "Shared secret used to sign Set/Remove/Purge requests between peers")
+	//命令行传入 port 和 api 等参数，用来在指定端口启动 HTTP 服务
 	flag.Parse()
 
-	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
-	}
-
-	var addrs []string
-	for _, v := range addrMap {
-		addrs = append(addrs, v)
+	addr, listen := fmt.Sprintf("http://localhost:%d", port), fmt.Sprintf("localhost:%d", port)
+	if advertise != "" {
+		addr, listen = strings.TrimSuffix(advertise, "/"), fmt.Sprintf(":%d", port)
+	} else if dnsName != "" {
+		//DNS 返回的是 IP 地址，自己的地址必须写成同样的形式
+		log.Fatal("-dns requires -advertise, e.g. -advertise=http://10.0.0.1:8001")
 	}
-
 	gee := createGroup()
 
-	fmt.Println(addrMap[port])
-	startCacheServer(addrMap[port], addrs, gee)
+	fmt.Println(addr)
+	startCacheServer(addr, listen, peerKey, newDiscovery(addr, port, peersFile, dnsName, gossipAddr, join, gossipKey), gee)
 }